@@ -0,0 +1,449 @@
+package pulsarClient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminClient is a client for the Pulsar admin REST API (/admin/v2) of a broker or proxy, for
+// provisioning tenants, namespaces, topics and subscriptions and inspecting backlogs.
+type AdminClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// AdminOption customises an AdminClient.
+type AdminOption func(*AdminClient)
+
+// WithAdminToken authenticates requests with a JWT bearer token.
+func WithAdminToken(token string) AdminOption {
+	return func(a *AdminClient) {
+		a.token = token
+	}
+}
+
+// WithAdminHTTPClient sets the HTTP client, e.g. one configured for TLS.
+func WithAdminHTTPClient(client *http.Client) AdminOption {
+	return func(a *AdminClient) {
+		a.httpClient = client
+	}
+}
+
+// NewAdminClient creates an admin client for the web service at baseURL, such as
+// http://pulsar:8080. An empty baseURL is read from PULSAR.ADMIN.URL, and without WithAdminToken
+// the token in PULSAR.AUTH.TOKEN is used if set.
+func NewAdminClient(baseURL string, opts ...AdminOption) *AdminClient {
+	if baseURL == "" {
+		baseURL = os.Getenv("PULSAR.ADMIN.URL")
+	}
+	a := &AdminClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      os.Getenv("PULSAR.AUTH.TOKEN"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// AdminError is returned for admin API responses with a non-2xx status.
+type AdminError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Reason     string
+}
+
+func (e *AdminError) Error() string {
+	return fmt.Sprintf("pulsar admin %s %s failed with status %d: %s", e.Method, e.Path, e.StatusCode, e.Reason)
+}
+
+// NotFound reports whether the tenant, namespace, topic or subscription does not exist.
+func (e *AdminError) NotFound() bool {
+	return e.StatusCode == http.StatusNotFound
+}
+
+// Conflict reports whether the resource being created already exists.
+func (e *AdminError) Conflict() bool {
+	return e.StatusCode == http.StatusConflict
+}
+
+// TenantInfo describes a tenant.
+type TenantInfo struct {
+	AdminRoles      []string `json:"adminRoles"`
+	AllowedClusters []string `json:"allowedClusters"`
+}
+
+// RetentionPolicy keeps acknowledged messages for up to RetentionTimeInMinutes and
+// RetentionSizeInMB, whichever is reached first. -1 means unlimited.
+type RetentionPolicy struct {
+	RetentionTimeInMinutes int   `json:"retentionTimeInMinutes"`
+	RetentionSizeInMB      int64 `json:"retentionSizeInMB"`
+}
+
+// BacklogQuotaPolicy is what the broker does once a backlog quota is exceeded.
+type BacklogQuotaPolicy string
+
+const (
+	BacklogQuotaProducerHold      BacklogQuotaPolicy = "producer_request_hold"
+	BacklogQuotaProducerException BacklogQuotaPolicy = "producer_exception"
+	BacklogQuotaConsumerEviction  BacklogQuotaPolicy = "consumer_backlog_eviction"
+)
+
+// BacklogQuota limits the unacknowledged backlog of each topic in a namespace by size (bytes),
+// by age (seconds) or both; zero leaves a limit unset.
+type BacklogQuota struct {
+	LimitSize int64              `json:"limitSize,omitempty"`
+	LimitTime int64              `json:"limitTime,omitempty"`
+	Policy    BacklogQuotaPolicy `json:"policy"`
+}
+
+// TopicStats is the subset of topic statistics useful for monitoring backlogs.
+type TopicStats struct {
+	MsgRateIn     float64                      `json:"msgRateIn"`
+	MsgRateOut    float64                      `json:"msgRateOut"`
+	MsgInCounter  int64                        `json:"msgInCounter"`
+	StorageSize   int64                        `json:"storageSize"`
+	BacklogSize   int64                        `json:"backlogSize"`
+	Subscriptions map[string]SubscriptionStats `json:"subscriptions"`
+}
+
+// SubscriptionStats reports the backlog and throughput of one subscription.
+type SubscriptionStats struct {
+	Type             string          `json:"type"`
+	MsgBacklog       int64           `json:"msgBacklog"`
+	BacklogSize      int64           `json:"backlogSize"`
+	UnackedMessages  int64           `json:"unackedMessages"`
+	MsgRateOut       float64         `json:"msgRateOut"`
+	MsgRateRedeliver float64         `json:"msgRateRedeliver"`
+	MsgRateExpired   float64         `json:"msgRateExpired"`
+	Consumers        []ConsumerStats `json:"consumers"`
+}
+
+// ConsumerStats reports one consumer connected to a subscription.
+type ConsumerStats struct {
+	ConsumerName    string  `json:"consumerName"`
+	MsgRateOut      float64 `json:"msgRateOut"`
+	UnackedMessages int64   `json:"unackedMessages"`
+	Address         string  `json:"address"`
+}
+
+// CreateTenant creates tenant with the admin roles and allowed clusters in info.
+func (a *AdminClient) CreateTenant(ctx context.Context, tenant string, info TenantInfo) error {
+	return a.do(ctx, http.MethodPut, "/tenants/"+url.PathEscape(tenant), info, nil)
+}
+
+// ListTenants returns the names of all tenants.
+func (a *AdminClient) ListTenants(ctx context.Context) ([]string, error) {
+	var tenants []string
+	err := a.do(ctx, http.MethodGet, "/tenants", nil, &tenants)
+	return tenants, err
+}
+
+// CreateNamespace creates namespace, given as tenant/namespace.
+func (a *AdminClient) CreateNamespace(ctx context.Context, namespace string) error {
+	return a.do(ctx, http.MethodPut, "/namespaces/"+namespace, nil, nil)
+}
+
+// ListNamespaces returns the namespaces of tenant, as tenant/namespace.
+func (a *AdminClient) ListNamespaces(ctx context.Context, tenant string) ([]string, error) {
+	var namespaces []string
+	err := a.do(ctx, http.MethodGet, "/namespaces/"+url.PathEscape(tenant), nil, &namespaces)
+	return namespaces, err
+}
+
+// CreateTopic creates a topic with the given number of partitions, or a non-partitioned topic
+// when partitions is 0. Short names are resolved like producer topics (persistent://public/default).
+func (a *AdminClient) CreateTopic(ctx context.Context, topic string, partitions int) error {
+	path, err := topicPath(topic)
+	if err != nil {
+		return err
+	}
+	if partitions > 0 {
+		return a.do(ctx, http.MethodPut, path+"/partitions", partitions, nil)
+	}
+	return a.do(ctx, http.MethodPut, path, nil, nil)
+}
+
+// DeleteTopic deletes a topic, including all partitions of a partitioned topic. With force it
+// also disconnects its producers and consumers.
+func (a *AdminClient) DeleteTopic(ctx context.Context, topic string, partitioned, force bool) error {
+	path, err := topicPath(topic)
+	if err != nil {
+		return err
+	}
+	if partitioned {
+		path += "/partitions"
+	}
+	return a.do(ctx, http.MethodDelete, path+"?force="+strconv.FormatBool(force), nil, nil)
+}
+
+// ListTopics returns the persistent topics of namespace (tenant/namespace): non-partitioned topics
+// and partitioned topics, the latter by their base name rather than per partition.
+func (a *AdminClient) ListTopics(ctx context.Context, namespace string) ([]string, error) {
+	var topics, partitioned []string
+	if err := a.do(ctx, http.MethodGet, "/persistent/"+namespace, nil, &topics); err != nil {
+		return nil, err
+	}
+	if err := a.do(ctx, http.MethodGet, "/persistent/"+namespace+"/partitioned", nil, &partitioned); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(topics)+len(partitioned))
+	var all []string
+	for _, topic := range append(partitioned, topics...) {
+		topic = baseTopic(topic)
+		if !seen[topic] {
+			seen[topic] = true
+			all = append(all, topic)
+		}
+	}
+	return all, nil
+}
+
+// PartitionCount returns the number of partitions of topic, 0 for a non-partitioned topic.
+func (a *AdminClient) PartitionCount(ctx context.Context, topic string) (int, error) {
+	path, err := topicPath(topic)
+	if err != nil {
+		return 0, err
+	}
+	var metadata struct {
+		Partitions int `json:"partitions"`
+	}
+	err = a.do(ctx, http.MethodGet, path+"/partitions", nil, &metadata)
+	return metadata.Partitions, err
+}
+
+// UpdatePartitionCount grows a partitioned topic to partitions. Partitions cannot be removed.
+func (a *AdminClient) UpdatePartitionCount(ctx context.Context, topic string, partitions int) error {
+	path, err := topicPath(topic)
+	if err != nil {
+		return err
+	}
+	return a.do(ctx, http.MethodPost, path+"/partitions", partitions, nil)
+}
+
+// SetMessageTTL expires unacknowledged messages in namespace after ttl; 0 disables expiry.
+func (a *AdminClient) SetMessageTTL(ctx context.Context, namespace string, ttl time.Duration) error {
+	return a.do(ctx, http.MethodPost, "/namespaces/"+namespace+"/messageTTL", int(ttl.Seconds()), nil)
+}
+
+// MessageTTL returns the message TTL of namespace, 0 when none is set.
+func (a *AdminClient) MessageTTL(ctx context.Context, namespace string) (time.Duration, error) {
+	var seconds *int
+	if err := a.do(ctx, http.MethodGet, "/namespaces/"+namespace+"/messageTTL", nil, &seconds); err != nil || seconds == nil {
+		return 0, err
+	}
+	return time.Duration(*seconds) * time.Second, nil
+}
+
+// SetRetention sets the retention policy of namespace.
+func (a *AdminClient) SetRetention(ctx context.Context, namespace string, policy RetentionPolicy) error {
+	return a.do(ctx, http.MethodPost, "/namespaces/"+namespace+"/retention", policy, nil)
+}
+
+// Retention returns the retention policy of namespace.
+func (a *AdminClient) Retention(ctx context.Context, namespace string) (RetentionPolicy, error) {
+	var policy RetentionPolicy
+	err := a.do(ctx, http.MethodGet, "/namespaces/"+namespace+"/retention", nil, &policy)
+	return policy, err
+}
+
+// SetBacklogQuota sets the backlog quota of namespace. The broker keeps size and age limits as
+// separate quotas, so LimitSize is set as a destination_storage quota and LimitTime as a
+// message_age quota, both with Policy.
+func (a *AdminClient) SetBacklogQuota(ctx context.Context, namespace string, quota BacklogQuota) error {
+	path := "/namespaces/" + namespace + "/backlogQuota?backlogQuotaType="
+	if quota.LimitSize > 0 || quota.LimitTime <= 0 {
+		size := BacklogQuota{LimitSize: quota.LimitSize, Policy: quota.Policy}
+		if err := a.do(ctx, http.MethodPost, path+"destination_storage", size, nil); err != nil {
+			return err
+		}
+	}
+	if quota.LimitTime > 0 {
+		age := BacklogQuota{LimitTime: quota.LimitTime, Policy: quota.Policy}
+		return a.do(ctx, http.MethodPost, path+"message_age", age, nil)
+	}
+	return nil
+}
+
+// BacklogQuotas returns the backlog quotas of namespace by quota type.
+func (a *AdminClient) BacklogQuotas(ctx context.Context, namespace string) (map[string]BacklogQuota, error) {
+	quotas := make(map[string]BacklogQuota)
+	err := a.do(ctx, http.MethodGet, "/namespaces/"+namespace+"/backlogQuotaMap", nil, &quotas)
+	return quotas, err
+}
+
+// CreateSubscription creates subscription on topic, positioned at the end of the topic or, with
+// fromEarliest, at the oldest retained message.
+func (a *AdminClient) CreateSubscription(ctx context.Context, topic, subscription string, fromEarliest bool) error {
+	path, err := subscriptionPath(topic, subscription)
+	if err != nil {
+		return err
+	}
+	var position any
+	if fromEarliest {
+		position = map[string]int64{"ledgerId": -1, "entryId": -1, "partitionIndex": -1}
+	}
+	return a.do(ctx, http.MethodPut, path, position, nil)
+}
+
+// DeleteSubscription deletes subscription from topic. With force its consumers are disconnected first.
+func (a *AdminClient) DeleteSubscription(ctx context.Context, topic, subscription string, force bool) error {
+	path, err := subscriptionPath(topic, subscription)
+	if err != nil {
+		return err
+	}
+	return a.do(ctx, http.MethodDelete, path+"?force="+strconv.FormatBool(force), nil, nil)
+}
+
+// ListSubscriptions returns the subscriptions of topic.
+func (a *AdminClient) ListSubscriptions(ctx context.Context, topic string) ([]string, error) {
+	path, err := topicPath(topic)
+	if err != nil {
+		return nil, err
+	}
+	var subscriptions []string
+	err = a.do(ctx, http.MethodGet, path+"/subscriptions", nil, &subscriptions)
+	return subscriptions, err
+}
+
+// TopicStats returns the statistics of a non-partitioned topic, or with partitioned the aggregated
+// statistics of all partitions of a partitioned topic.
+func (a *AdminClient) TopicStats(ctx context.Context, topic string, partitioned bool) (TopicStats, error) {
+	var stats TopicStats
+	path, err := topicPath(topic)
+	if err != nil {
+		return stats, err
+	}
+	if partitioned {
+		path += "/partitioned-stats"
+	} else {
+		path += "/stats"
+	}
+	err = a.do(ctx, http.MethodGet, path, nil, &stats)
+	return stats, err
+}
+
+// SubscriptionBacklog returns the backlog statistics of one subscription of topic.
+func (a *AdminClient) SubscriptionBacklog(ctx context.Context, topic, subscription string, partitioned bool) (SubscriptionStats, error) {
+	stats, err := a.TopicStats(ctx, topic, partitioned)
+	if err != nil {
+		return SubscriptionStats{}, err
+	}
+	sub, found := stats.Subscriptions[subscription]
+	if !found {
+		return SubscriptionStats{}, &AdminError{Method: http.MethodGet, Path: topic, StatusCode: http.StatusNotFound, Reason: "subscription " + subscription + " not found"}
+	}
+	return sub, nil
+}
+
+// ResetCursor moves subscription back or forward to the first message published at or after
+// timestamp. Messages after that point are redelivered, or skipped when moving forward.
+func (a *AdminClient) ResetCursor(ctx context.Context, topic, subscription string, timestamp time.Time) error {
+	path, err := subscriptionPath(topic, subscription)
+	if err != nil {
+		return err
+	}
+	return a.do(ctx, http.MethodPost, path+"/resetcursor/"+strconv.FormatInt(timestamp.UnixMilli(), 10), nil, nil)
+}
+
+// SkipMessages acknowledges the next count messages of subscription without delivering them.
+func (a *AdminClient) SkipMessages(ctx context.Context, topic, subscription string, count int) error {
+	path, err := subscriptionPath(topic, subscription)
+	if err != nil {
+		return err
+	}
+	return a.do(ctx, http.MethodPost, path+"/skip/"+strconv.Itoa(count), nil, nil)
+}
+
+// ClearBacklog acknowledges every pending message of subscription.
+func (a *AdminClient) ClearBacklog(ctx context.Context, topic, subscription string) error {
+	path, err := subscriptionPath(topic, subscription)
+	if err != nil {
+		return err
+	}
+	return a.do(ctx, http.MethodPost, path+"/skip_all", nil, nil)
+}
+
+// topicPath converts a topic name to its REST path, /persistent/tenant/namespace/topic.
+func topicPath(topic string) (string, error) {
+	domain, name, _ := strings.Cut(qualifiedTopic(topic), "://")
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", fmt.Errorf("invalid topic name %s: expected tenant/namespace/topic", topic)
+	}
+	return "/" + domain + "/" + parts[0] + "/" + parts[1] + "/" + url.PathEscape(parts[2]), nil
+}
+
+func subscriptionPath(topic, subscription string) (string, error) {
+	path, err := topicPath(topic)
+	if err != nil {
+		return "", err
+	}
+	return path + "/subscription/" + url.PathEscape(subscription), nil
+}
+
+// do sends a request to the admin API, encoding body and decoding the response into result when
+// they are not nil.
+func (a *AdminClient) do(ctx context.Context, method, path string, body, result any) error {
+	if a.baseURL == "" {
+		return fmt.Errorf("no admin URL configured (PULSAR.ADMIN.URL)")
+	}
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode admin request %s %s: %w", method, path, err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+"/admin/v2"+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build admin request %s %s: %w", method, path, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("pulsar admin %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read admin response %s %s: %w", method, path, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		adminErr := &AdminError{Method: method, Path: path, StatusCode: resp.StatusCode, Reason: strings.TrimSpace(string(data))}
+		var reason struct {
+			Reason string `json:"reason"`
+		}
+		if json.Unmarshal(data, &reason) == nil && reason.Reason != "" {
+			adminErr.Reason = reason.Reason
+		}
+		return adminErr
+	}
+	if result != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("failed to decode admin response %s %s: %w", method, path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,338 @@
+package pulsarClient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// adminRequest is a request received by the admin stand-in.
+type adminRequest struct {
+	method        string
+	uri           string
+	authorization string
+	body          string
+}
+
+// adminStandIn is an httptest stand-in of the admin endpoints. It records every request and
+// answers with the response registered for "METHOD path", or an empty 204.
+type adminStandIn struct {
+	*httptest.Server
+	mu        sync.Mutex
+	requests  []adminRequest
+	responses map[string]adminResponse
+}
+
+type adminResponse struct {
+	status int
+	body   string
+}
+
+func newAdminStandIn(t *testing.T) *adminStandIn {
+	t.Helper()
+	s := &adminStandIn{responses: make(map[string]adminResponse)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.requests = append(s.requests, adminRequest{
+			method:        r.Method,
+			uri:           r.URL.RequestURI(),
+			authorization: r.Header.Get("Authorization"),
+			body:          string(body),
+		})
+		response, found := s.responses[r.Method+" "+r.URL.Path]
+		s.mu.Unlock()
+		if !found {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(response.status)
+		io.WriteString(w, response.body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *adminStandIn) respond(method, path string, status int, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[method+" "+path] = adminResponse{status: status, body: body}
+}
+
+// last returns the most recent request.
+func (s *adminStandIn) last(t *testing.T) adminRequest {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		t.Fatal("no admin request received")
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+func (s *adminStandIn) client() *AdminClient {
+	return NewAdminClient(s.URL+"/", WithAdminToken("admin-token"))
+}
+
+func TestTopicPath(t *testing.T) {
+	tests := []struct {
+		topic string
+		want  string
+	}{
+		{"orders", "/persistent/public/default/orders"},
+		{"acme/billing/orders", "/persistent/acme/billing/orders"},
+		{"persistent://acme/billing/orders", "/persistent/acme/billing/orders"},
+		{"non-persistent://acme/billing/replies", "/non-persistent/acme/billing/replies"},
+		{"acme/billing/orders eu", "/persistent/acme/billing/orders%20eu"},
+	}
+	for _, tt := range tests {
+		got, err := topicPath(tt.topic)
+		if err != nil || got != tt.want {
+			t.Errorf("topicPath(%q) = %q, %v; want %q", tt.topic, got, err, tt.want)
+		}
+	}
+
+	for _, topic := range []string{"billing/orders", "persistent://acme/billing", "persistent://acme//orders", "a/b/c/d"} {
+		if path, err := topicPath(topic); err == nil {
+			t.Errorf("topicPath(%q) = %q, want an error", topic, path)
+		}
+	}
+
+	path, err := subscriptionPath("orders", "billing worker")
+	if err != nil || path != "/persistent/public/default/orders/subscription/billing%20worker" {
+		t.Errorf("subscriptionPath = %q, %v", path, err)
+	}
+}
+
+func TestAdminCreateTopic(t *testing.T) {
+	standIn := newAdminStandIn(t)
+	admin := standIn.client()
+	ctx := context.Background()
+
+	if err := admin.CreateTopic(ctx, "orders", 4); err != nil {
+		t.Fatal(err)
+	}
+	request := standIn.last(t)
+	if request.method != http.MethodPut || request.uri != "/admin/v2/persistent/public/default/orders/partitions" || request.body != "4" {
+		t.Fatalf("partitioned topic created with %+v", request)
+	}
+	if request.authorization != "Bearer admin-token" {
+		t.Fatalf("authorization header %q", request.authorization)
+	}
+
+	if err := admin.CreateTopic(ctx, "acme/billing/invoices", 0); err != nil {
+		t.Fatal(err)
+	}
+	request = standIn.last(t)
+	if request.method != http.MethodPut || request.uri != "/admin/v2/persistent/acme/billing/invoices" || request.body != "" {
+		t.Fatalf("non-partitioned topic created with %+v", request)
+	}
+
+	if err := admin.CreateTopic(ctx, "billing/invoices", 0); err == nil {
+		t.Fatal("invalid topic name accepted")
+	}
+}
+
+func TestAdminPartitionedBranches(t *testing.T) {
+	standIn := newAdminStandIn(t)
+	admin := standIn.client()
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+		want string
+	}{
+		{"delete partitioned", func() error { return admin.DeleteTopic(ctx, "orders", true, true) },
+			"DELETE /admin/v2/persistent/public/default/orders/partitions?force=true"},
+		{"delete non-partitioned", func() error { return admin.DeleteTopic(ctx, "orders", false, false) },
+			"DELETE /admin/v2/persistent/public/default/orders?force=false"},
+		{"partitioned stats", func() error { _, err := admin.TopicStats(ctx, "orders", true); return err },
+			"GET /admin/v2/persistent/public/default/orders/partitioned-stats"},
+		{"stats", func() error { _, err := admin.TopicStats(ctx, "orders", false); return err },
+			"GET /admin/v2/persistent/public/default/orders/stats"},
+		{"grow partitions", func() error { return admin.UpdatePartitionCount(ctx, "orders", 8) },
+			"POST /admin/v2/persistent/public/default/orders/partitions"},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if request := standIn.last(t); request.method+" "+request.uri != tt.want {
+			t.Errorf("%s: sent %s %s, want %s", tt.name, request.method, request.uri, tt.want)
+		}
+	}
+
+	standIn.respond(http.MethodGet, "/admin/v2/persistent/public/default/orders/partitions", http.StatusOK, `{"partitions":4}`)
+	standIn.respond(http.MethodGet, "/admin/v2/persistent/public/default/invoices/partitions", http.StatusOK, `{"partitions":0}`)
+	if count, err := admin.PartitionCount(ctx, "orders"); err != nil || count != 4 {
+		t.Fatalf("PartitionCount(orders) = %d, %v", count, err)
+	}
+	if count, err := admin.PartitionCount(ctx, "invoices"); err != nil || count != 0 {
+		t.Fatalf("PartitionCount(invoices) = %d, %v", count, err)
+	}
+}
+
+func TestAdminListTopics(t *testing.T) {
+	standIn := newAdminStandIn(t)
+	standIn.respond(http.MethodGet, "/admin/v2/persistent/acme/billing", http.StatusOK,
+		`["persistent://acme/billing/orders-partition-0","persistent://acme/billing/orders-partition-1","persistent://acme/billing/invoices"]`)
+	standIn.respond(http.MethodGet, "/admin/v2/persistent/acme/billing/partitioned", http.StatusOK,
+		`["persistent://acme/billing/orders"]`)
+
+	topics, err := standIn.client().ListTopics(context.Background(), "acme/billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"persistent://acme/billing/orders", "persistent://acme/billing/invoices"}
+	if strings.Join(topics, ",") != strings.Join(want, ",") {
+		t.Fatalf("ListTopics = %v, want %v", topics, want)
+	}
+}
+
+func TestAdminBacklogQuotaType(t *testing.T) {
+	standIn := newAdminStandIn(t)
+	admin := standIn.client()
+	ctx := context.Background()
+
+	if err := admin.SetBacklogQuota(ctx, "acme/billing", BacklogQuota{LimitSize: 1 << 30, Policy: BacklogQuotaProducerHold}); err != nil {
+		t.Fatal(err)
+	}
+	request := standIn.last(t)
+	if request.uri != "/admin/v2/namespaces/acme/billing/backlogQuota?backlogQuotaType=destination_storage" {
+		t.Fatalf("size quota sent to %s", request.uri)
+	}
+	var quota map[string]any
+	if err := json.Unmarshal([]byte(request.body), &quota); err != nil {
+		t.Fatal(err)
+	}
+	if quota["limitSize"] != float64(1<<30) || quota["policy"] != "producer_request_hold" || quota["limitTime"] != nil {
+		t.Fatalf("size quota body %s", request.body)
+	}
+
+	if err := admin.SetBacklogQuota(ctx, "acme/billing", BacklogQuota{LimitTime: 3600, Policy: BacklogQuotaConsumerEviction}); err != nil {
+		t.Fatal(err)
+	}
+	if request := standIn.last(t); request.uri != "/admin/v2/namespaces/acme/billing/backlogQuota?backlogQuotaType=message_age" {
+		t.Fatalf("age quota sent to %s", request.uri)
+	}
+
+	sent := len(standIn.requests)
+	if err := admin.SetBacklogQuota(ctx, "acme/billing", BacklogQuota{LimitSize: 1 << 20, LimitTime: 60, Policy: BacklogQuotaProducerException}); err != nil {
+		t.Fatal(err)
+	}
+	both := standIn.requests[sent:]
+	if len(both) != 2 ||
+		both[0].uri != "/admin/v2/namespaces/acme/billing/backlogQuota?backlogQuotaType=destination_storage" ||
+		both[0].body != `{"limitSize":1048576,"policy":"producer_exception"}` ||
+		both[1].uri != "/admin/v2/namespaces/acme/billing/backlogQuota?backlogQuotaType=message_age" ||
+		both[1].body != `{"limitTime":60,"policy":"producer_exception"}` {
+		t.Fatalf("size and age quota sent as %+v", both)
+	}
+}
+
+func TestAdminCreateSubscription(t *testing.T) {
+	standIn := newAdminStandIn(t)
+	admin := standIn.client()
+	ctx := context.Background()
+
+	if err := admin.CreateSubscription(ctx, "orders", "billing", true); err != nil {
+		t.Fatal(err)
+	}
+	request := standIn.last(t)
+	if request.method != http.MethodPut || request.uri != "/admin/v2/persistent/public/default/orders/subscription/billing" {
+		t.Fatalf("subscription created with %+v", request)
+	}
+	var position map[string]int64
+	if err := json.Unmarshal([]byte(request.body), &position); err != nil {
+		t.Fatalf("earliest position body %q: %v", request.body, err)
+	}
+	if position["ledgerId"] != -1 || position["entryId"] != -1 || position["partitionIndex"] != -1 {
+		t.Fatalf("earliest position %v", position)
+	}
+
+	if err := admin.CreateSubscription(ctx, "orders", "audit", false); err != nil {
+		t.Fatal(err)
+	}
+	if request := standIn.last(t); request.body != "" {
+		t.Fatalf("latest position sent body %q", request.body)
+	}
+}
+
+func TestAdminCursorAndBacklog(t *testing.T) {
+	standIn := newAdminStandIn(t)
+	admin := standIn.client()
+	ctx := context.Background()
+	base := "/admin/v2/persistent/public/default/orders/subscription/billing"
+
+	if err := admin.ResetCursor(ctx, "orders", "billing", time.UnixMilli(1700000000123)); err != nil {
+		t.Fatal(err)
+	}
+	if request := standIn.last(t); request.method != http.MethodPost || request.uri != base+"/resetcursor/1700000000123" {
+		t.Fatalf("ResetCursor sent %s %s", request.method, request.uri)
+	}
+	if err := admin.SkipMessages(ctx, "orders", "billing", 25); err != nil {
+		t.Fatal(err)
+	}
+	if request := standIn.last(t); request.uri != base+"/skip/25" {
+		t.Fatalf("SkipMessages sent %s", request.uri)
+	}
+	if err := admin.ClearBacklog(ctx, "orders", "billing"); err != nil {
+		t.Fatal(err)
+	}
+	if request := standIn.last(t); request.uri != base+"/skip_all" {
+		t.Fatalf("ClearBacklog sent %s", request.uri)
+	}
+
+	standIn.respond(http.MethodGet, "/admin/v2/persistent/public/default/orders/stats", http.StatusOK,
+		`{"msgRateIn":5,"subscriptions":{"billing":{"type":"Shared","msgBacklog":42,"unackedMessages":3}}}`)
+	stats, err := admin.SubscriptionBacklog(ctx, "orders", "billing", false)
+	if err != nil || stats.MsgBacklog != 42 || stats.UnackedMessages != 3 || stats.Type != "Shared" {
+		t.Fatalf("SubscriptionBacklog = %+v, %v", stats, err)
+	}
+	var adminErr *AdminError
+	if _, err := admin.SubscriptionBacklog(ctx, "orders", "missing", false); !errors.As(err, &adminErr) || !adminErr.NotFound() {
+		t.Fatalf("missing subscription returned %v", err)
+	}
+}
+
+func TestAdminErrorReason(t *testing.T) {
+	standIn := newAdminStandIn(t)
+	admin := standIn.client()
+	ctx := context.Background()
+
+	standIn.respond(http.MethodPut, "/admin/v2/tenants/acme", http.StatusConflict, `{"reason":"Tenant already exists"}`)
+	err := admin.CreateTenant(ctx, "acme", TenantInfo{AllowedClusters: []string{"standalone"}})
+	var adminErr *AdminError
+	if !errors.As(err, &adminErr) {
+		t.Fatalf("got %v, want an AdminError", err)
+	}
+	if !adminErr.Conflict() || adminErr.NotFound() || adminErr.Reason != "Tenant already exists" ||
+		adminErr.Method != http.MethodPut || adminErr.Path != "/tenants/acme" {
+		t.Fatalf("unexpected error %+v", adminErr)
+	}
+
+	standIn.respond(http.MethodGet, "/admin/v2/namespaces/acme/billing/retention", http.StatusNotFound, "Namespace does not exist\n")
+	_, err = admin.Retention(ctx, "acme/billing")
+	if !errors.As(err, &adminErr) || !adminErr.NotFound() || adminErr.Reason != "Namespace does not exist" {
+		t.Fatalf("plain-text error parsed as %v", err)
+	}
+
+	standIn.respond(http.MethodGet, "/admin/v2/tenants", http.StatusInternalServerError, `{"message":"boom"}`)
+	_, err = admin.ListTenants(ctx)
+	if !errors.As(err, &adminErr) || adminErr.StatusCode != http.StatusInternalServerError || adminErr.Reason != `{"message":"boom"}` {
+		t.Fatalf("JSON error without reason parsed as %v", err)
+	}
+
+	t.Setenv("PULSAR.ADMIN.URL", "")
+	if err := NewAdminClient("").CreateNamespace(ctx, "acme/billing"); err == nil {
+		t.Fatal("request sent without an admin URL")
+	}
+}
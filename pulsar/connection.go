@@ -0,0 +1,222 @@
+package pulsarClient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// ConnectionOptions describes how Connect reaches the cluster: the service URL, an optional
+// authentication mode and TLS settings. Without WithConnection they are read from PULSAR.*
+// environment variables, named next to each field.
+type ConnectionOptions struct {
+	// URL is the service URL, pulsar://host:6650 or pulsar+ssl://host:6651. PULSAR.URL.
+	URL string
+	// BackupURLs are service URLs of standby clusters to fail over to when URL stops answering
+	// health probes, tried in order. They share the authentication and TLS settings below.
+	// PULSAR.BACKUP.URLS, separated by semicolons since a service URL may itself list hosts
+	// separated by commas.
+	BackupURLs []string
+	// Failover tunes the health probes; it only applies when BackupURLs are set.
+	// PULSAR.FAILOVER.PROBE.INTERVAL takes a duration such as 15s.
+	Failover FailoverOptions
+
+	// AuthToken enables JWT token authentication. PULSAR.AUTH.TOKEN.
+	AuthToken string
+	// AuthTokenFile enables token authentication with a token read from a file, so rotated tokens
+	// are picked up. PULSAR.AUTH.TOKEN.FILE.
+	AuthTokenFile string
+	// OAuth2 enables OAuth2 client credentials authentication.
+	OAuth2 *OAuth2Options
+
+	// TLSTrustCertsFile is the CA bundle used to verify the broker. PULSAR.TLS.TRUST.CERTS.FILE.
+	TLSTrustCertsFile string
+	// TLSCertFile and TLSKeyFile are the client certificate and key for mutual TLS. On their own
+	// they also authenticate the client to the broker. PULSAR.TLS.CERT.FILE and PULSAR.TLS.KEY.FILE.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSAllowInsecureConnection accepts broker certificates that do not verify.
+	// PULSAR.TLS.ALLOW.INSECURE.
+	TLSAllowInsecureConnection bool
+	// TLSValidateHostname checks that the broker certificate matches its host name. Go checks the
+	// host name of every certificate it verifies, so leaving this off does not relax verification;
+	// only TLSAllowInsecureConnection does. PULSAR.TLS.VALIDATE.HOSTNAME.
+	TLSValidateHostname bool
+}
+
+// OAuth2Options configures OAuth2 client credentials authentication. The client either reads its
+// ID and secret from CredentialsFile (a JSON key file with client_id and client_secret) or takes
+// them from ClientID and ClientSecret.
+type OAuth2Options struct {
+	// IssuerURL is the authorization server. PULSAR.OAUTH2.ISSUER.URL.
+	IssuerURL string
+	// Audience identifies the cluster to the authorization server. PULSAR.OAUTH2.AUDIENCE.
+	Audience string
+	// Scope is optional. PULSAR.OAUTH2.SCOPE.
+	Scope string
+	// CredentialsFile is the path of the key file. PULSAR.OAUTH2.CREDENTIALS.FILE.
+	CredentialsFile string
+	// ClientID and ClientSecret are used when there is no key file. PULSAR.OAUTH2.CLIENT.ID and
+	// PULSAR.OAUTH2.CLIENT.SECRET.
+	ClientID     string
+	ClientSecret string
+}
+
+// WithConnection sets the connection options instead of reading them from the environment.
+func WithConnection(options ConnectionOptions) ClientOption {
+	return func(p *pulsarClient) {
+		p.connection = &options
+	}
+}
+
+// connectionOptionsFromEnv reads ConnectionOptions from the PULSAR.* environment variables.
+func connectionOptionsFromEnv() (ConnectionOptions, error) {
+	options := ConnectionOptions{
+		URL:               os.Getenv("PULSAR.URL"),
+		AuthToken:         os.Getenv("PULSAR.AUTH.TOKEN"),
+		AuthTokenFile:     os.Getenv("PULSAR.AUTH.TOKEN.FILE"),
+		TLSTrustCertsFile: os.Getenv("PULSAR.TLS.TRUST.CERTS.FILE"),
+		TLSCertFile:       os.Getenv("PULSAR.TLS.CERT.FILE"),
+		TLSKeyFile:        os.Getenv("PULSAR.TLS.KEY.FILE"),
+	}
+	for _, backup := range strings.Split(os.Getenv("PULSAR.BACKUP.URLS"), ";") {
+		if trimmed := strings.TrimSpace(backup); trimmed != "" {
+			options.BackupURLs = append(options.BackupURLs, trimmed)
+		}
+	}
+	var err error
+	if interval := os.Getenv("PULSAR.FAILOVER.PROBE.INTERVAL"); interval != "" {
+		if options.Failover.ProbeInterval, err = time.ParseDuration(interval); err != nil {
+			return options, fmt.Errorf("invalid PULSAR.FAILOVER.PROBE.INTERVAL value %q: %w", interval, err)
+		}
+	}
+	if options.TLSAllowInsecureConnection, err = envBool("PULSAR.TLS.ALLOW.INSECURE"); err != nil {
+		return options, err
+	}
+	if options.TLSValidateHostname, err = envBool("PULSAR.TLS.VALIDATE.HOSTNAME"); err != nil {
+		return options, err
+	}
+	if issuer := os.Getenv("PULSAR.OAUTH2.ISSUER.URL"); issuer != "" {
+		options.OAuth2 = &OAuth2Options{
+			IssuerURL:       issuer,
+			Audience:        os.Getenv("PULSAR.OAUTH2.AUDIENCE"),
+			Scope:           os.Getenv("PULSAR.OAUTH2.SCOPE"),
+			CredentialsFile: os.Getenv("PULSAR.OAUTH2.CREDENTIALS.FILE"),
+			ClientID:        os.Getenv("PULSAR.OAUTH2.CLIENT.ID"),
+			ClientSecret:    os.Getenv("PULSAR.OAUTH2.CLIENT.SECRET"),
+		}
+	}
+	return options, nil
+}
+
+func envBool(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return false, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value %q: %w", name, value, err)
+	}
+	return parsed, nil
+}
+
+// authMode names the configured authentication for logging. It never includes credentials.
+func (o ConnectionOptions) authMode() string {
+	switch {
+	case o.AuthToken != "" || o.AuthTokenFile != "":
+		return "token"
+	case o.OAuth2 != nil:
+		return "oauth2"
+	case o.TLSCertFile != "":
+		return "tls"
+	default:
+		return "none"
+	}
+}
+
+// clientOptions validates o and converts it to Pulsar client options for url.
+func (o ConnectionOptions) clientOptions(url string) (pulsar.ClientOptions, error) {
+	options := pulsar.ClientOptions{
+		URL:                        url,
+		OperationTimeout:           30 * time.Second,
+		ConnectionTimeout:          30 * time.Second,
+		TLSTrustCertsFilePath:      o.TLSTrustCertsFile,
+		TLSAllowInsecureConnection: o.TLSAllowInsecureConnection,
+		TLSValidateHostname:        o.TLSValidateHostname,
+	}
+	if url == "" {
+		return options, errors.New("no service URL configured (PULSAR.URL)")
+	}
+	if (o.TLSCertFile == "") != (o.TLSKeyFile == "") {
+		return options, errors.New("TLS client certificate and key must be set together")
+	}
+
+	hasToken := o.AuthToken != "" || o.AuthTokenFile != ""
+	if o.AuthToken != "" && o.AuthTokenFile != "" || hasToken && o.OAuth2 != nil {
+		return options, errors.New("only one of token, token file and OAuth2 authentication can be configured")
+	}
+
+	switch {
+	case o.AuthToken != "":
+		options.Authentication = pulsar.NewAuthenticationToken(o.AuthToken)
+	case o.AuthTokenFile != "":
+		options.Authentication = pulsar.NewAuthenticationTokenFromFile(o.AuthTokenFile)
+	case o.OAuth2 != nil:
+		params, err := o.OAuth2.params()
+		if err != nil {
+			return options, err
+		}
+		options.Authentication = pulsar.NewAuthenticationOAuth2(params)
+	}
+	if o.TLSCertFile != "" {
+		if options.Authentication == nil {
+			// The client certificate doubles as the credential.
+			options.Authentication = pulsar.NewAuthenticationTLS(o.TLSCertFile, o.TLSKeyFile)
+		} else {
+			// Mutual TLS alongside token or OAuth2 authentication.
+			options.TLSCertificateFile = o.TLSCertFile
+			options.TLSKeyFilePath = o.TLSKeyFile
+		}
+	}
+	return options, nil
+}
+
+// params converts o to the parameters of the Pulsar OAuth2 client credentials flow.
+func (o *OAuth2Options) params() (map[string]string, error) {
+	if o.IssuerURL == "" || o.Audience == "" {
+		return nil, errors.New("OAuth2 authentication needs an issuer URL and an audience")
+	}
+	params := map[string]string{
+		"type":      "client_credentials",
+		"issuerUrl": o.IssuerURL,
+		"audience":  o.Audience,
+		"scope":     o.Scope,
+	}
+	switch {
+	case o.CredentialsFile != "":
+		params["privateKey"] = "file://" + o.CredentialsFile
+	case o.ClientID != "" && o.ClientSecret != "":
+		// Pass the credentials inline rather than writing a key file to disk.
+		keyFile, err := json.Marshal(map[string]string{
+			"type":          "client_credentials",
+			"client_id":     o.ClientID,
+			"client_secret": o.ClientSecret,
+			"issuer_url":    o.IssuerURL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		params["privateKey"] = "data://" + string(keyFile)
+		params["clientId"] = o.ClientID
+	default:
+		return nil, errors.New("OAuth2 authentication needs a credentials file or a client ID and secret")
+	}
+	return params, nil
+}
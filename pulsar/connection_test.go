@@ -0,0 +1,408 @@
+package pulsarClient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/apache/pulsar-client-go/pulsar/log"
+)
+
+// testCA issues certificates for the test broker and clients.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "pulsar test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &testCA{cert: cert, key: key, file: filepath.Join(t.TempDir(), "ca.pem")}
+	writePEM(t, ca.file, "CERTIFICATE", der)
+	return ca
+}
+
+// issue returns the certificate and key files of a leaf certificate for hosts, which may be DNS
+// names or IP addresses.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage, hosts ...string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// connectAttempt is what the test broker saw of one client connection: the TLS handshake and the
+// credentials of the CONNECT command that follows it.
+type connectAttempt struct {
+	handshakeErr     error
+	clientCertName   string
+	authMethodName   string
+	authData         string
+	connectCommandOK bool
+}
+
+// testBroker is a TLS listener that records connection attempts and hangs up after each. It speaks
+// just enough of the Pulsar protocol to decode the CONNECT command. Clients retry, so every
+// broker serves a single connect call.
+type testBroker struct {
+	url      string
+	attempts chan connectAttempt
+}
+
+func newTestBroker(t *testing.T, ca *testCA, hosts ...string) *testBroker {
+	t.Helper()
+	certFile, keyFile := ca.issue(t, "broker", x509.ExtKeyUsageServerAuth, hosts...)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	broker := &testBroker{
+		url:      "pulsar+ssl://" + listener.Addr().String(),
+		attempts: make(chan connectAttempt, 100),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(conn.(*tls.Conn))
+		}
+	}()
+	return broker
+}
+
+func (b *testBroker) serve(conn *tls.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var attempt connectAttempt
+	if attempt.handshakeErr = conn.Handshake(); attempt.handshakeErr == nil {
+		if peers := conn.ConnectionState().PeerCertificates; len(peers) > 0 {
+			attempt.clientCertName = peers[0].Subject.CommonName
+		}
+		attempt.authMethodName, attempt.authData, attempt.connectCommandOK = readConnect(conn)
+	}
+	b.attempts <- attempt
+}
+
+// readConnect reads the first frame of a connection, [total size][command size][BaseCommand], and
+// decodes the auth_method_name and auth_data of its CommandConnect.
+func readConnect(r io.Reader) (authMethodName, authData string, ok bool) {
+	var sizes [8]byte
+	if _, err := io.ReadFull(r, sizes[:]); err != nil {
+		return "", "", false
+	}
+	command := make([]byte, binary.BigEndian.Uint32(sizes[4:]))
+	if _, err := io.ReadFull(r, command); err != nil {
+		return "", "", false
+	}
+	connect, found := protoField(command, 2) // BaseCommand.connect
+	if !found {
+		return "", "", false
+	}
+	method, _ := protoField(connect, 5) // CommandConnect.auth_method_name
+	data, _ := protoField(connect, 3)   // CommandConnect.auth_data
+	return string(method), string(data), true
+}
+
+// protoField returns the first length-delimited field number of a protobuf message.
+func protoField(message []byte, number uint64) ([]byte, bool) {
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return nil, false
+		}
+		message = message[n:]
+		switch tag & 7 {
+		case 0: // varint
+			if _, n = binary.Uvarint(message); n <= 0 {
+				return nil, false
+			}
+			message = message[n:]
+		case 2: // length-delimited
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return nil, false
+			}
+			value := message[n : n+int(length)]
+			message = message[n+int(length):]
+			if tag>>3 == number {
+				return value, true
+			}
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// connect builds a client from options, makes it connect to the broker and returns what the
+// broker saw.
+func (b *testBroker) connect(t *testing.T, options ConnectionOptions) connectAttempt {
+	t.Helper()
+	clientOptions, err := options.clientOptions(b.url)
+	if err != nil {
+		t.Fatalf("clientOptions: %v", err)
+	}
+	clientOptions.OperationTimeout = time.Second
+	clientOptions.ConnectionTimeout = time.Second
+	clientOptions.Logger = log.DefaultNopLogger()
+	client, err := pulsar.NewClient(clientOptions)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	// The broker hangs up after CONNECT, so this fails once the attempt has been recorded.
+	if producer, err := client.CreateProducer(pulsar.ProducerOptions{Topic: "persistent://public/default/connection-test"}); err == nil {
+		producer.Close()
+		t.Fatal("CreateProducer succeeded against the test broker")
+	}
+	select {
+	case attempt := <-b.attempts:
+		return attempt
+	case <-time.After(5 * time.Second):
+		t.Fatal("client never connected to the test broker")
+		return connectAttempt{}
+	}
+}
+
+func TestClientOptionsValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		options ConnectionOptions
+		want    string
+	}{
+		{"no URL", "", ConnectionOptions{}, "no service URL"},
+		{"certificate without key", "pulsar+ssl://broker:6651", ConnectionOptions{TLSCertFile: "client.pem"}, "set together"},
+		{"key without certificate", "pulsar+ssl://broker:6651", ConnectionOptions{TLSKeyFile: "client-key.pem"}, "set together"},
+		{"token and token file", "pulsar://broker:6650", ConnectionOptions{AuthToken: "t", AuthTokenFile: "token"}, "only one of"},
+		{"token and OAuth2", "pulsar://broker:6650", ConnectionOptions{AuthToken: "t", OAuth2: &OAuth2Options{IssuerURL: "https://issuer", Audience: "a", ClientID: "id", ClientSecret: "s"}}, "only one of"},
+		{"OAuth2 without audience", "pulsar://broker:6650", ConnectionOptions{OAuth2: &OAuth2Options{IssuerURL: "https://issuer", ClientID: "id", ClientSecret: "s"}}, "issuer URL and an audience"},
+		{"OAuth2 without credentials", "pulsar://broker:6650", ConnectionOptions{OAuth2: &OAuth2Options{IssuerURL: "https://issuer", Audience: "a", ClientID: "id"}}, "credentials file or a client ID and secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.options.clientOptions(tt.url)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectionOptionsFromEnv(t *testing.T) {
+	t.Setenv("PULSAR.URL", "pulsar+ssl://broker:6651")
+	t.Setenv("PULSAR.AUTH.TOKEN", "secret")
+	t.Setenv("PULSAR.TLS.TRUST.CERTS.FILE", "/etc/pulsar/ca.pem")
+	t.Setenv("PULSAR.TLS.VALIDATE.HOSTNAME", "true")
+	t.Setenv("PULSAR.OAUTH2.ISSUER.URL", "")
+
+	options, err := connectionOptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.URL != "pulsar+ssl://broker:6651" || options.AuthToken != "secret" ||
+		options.TLSTrustCertsFile != "/etc/pulsar/ca.pem" || !options.TLSValidateHostname {
+		t.Fatalf("unexpected options %+v", options)
+	}
+	if options.authMode() != "token" {
+		t.Fatalf("auth mode %s, want token", options.authMode())
+	}
+
+	t.Setenv("PULSAR.TLS.VALIDATE.HOSTNAME", "sometimes")
+	if _, err := connectionOptionsFromEnv(); err == nil {
+		t.Fatal("invalid boolean accepted")
+	}
+}
+
+func TestTLSWithCustomCA(t *testing.T) {
+	ca := newTestCA(t)
+
+	attempt := newTestBroker(t, ca, "127.0.0.1").connect(t, ConnectionOptions{TLSTrustCertsFile: ca.file})
+	if attempt.handshakeErr != nil || !attempt.connectCommandOK {
+		t.Fatalf("handshake with trusted CA failed: %+v", attempt)
+	}
+	if attempt.authMethodName != "" {
+		t.Fatalf("unexpected authentication %q", attempt.authMethodName)
+	}
+
+	if attempt := newTestBroker(t, ca, "127.0.0.1").connect(t, ConnectionOptions{}); attempt.handshakeErr == nil {
+		t.Fatal("broker certificate accepted without its CA")
+	}
+}
+
+func TestTokenAuthentication(t *testing.T) {
+	ca := newTestCA(t)
+
+	attempt := newTestBroker(t, ca, "127.0.0.1").connect(t, ConnectionOptions{AuthToken: "inline-token", TLSTrustCertsFile: ca.file})
+	if attempt.authMethodName != "token" || attempt.authData != "inline-token" {
+		t.Fatalf("got %+v, want token inline-token", attempt)
+	}
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	attempt = newTestBroker(t, ca, "127.0.0.1").connect(t, ConnectionOptions{AuthTokenFile: tokenFile, TLSTrustCertsFile: ca.file})
+	if attempt.authMethodName != "token" || attempt.authData != "file-token" {
+		t.Fatalf("got %+v, want token file-token", attempt)
+	}
+}
+
+func TestOAuth2Authentication(t *testing.T) {
+	issuer := httptest.NewServer(http.NewServeMux())
+	defer issuer.Close()
+	issuer.Config.Handler.(*http.ServeMux).HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"token_endpoint": issuer.URL + "/oauth/token"})
+	})
+	issuer.Config.Handler.(*http.ServeMux).HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("grant_type") != "client_credentials" || r.PostFormValue("client_id") != "client" ||
+			r.PostFormValue("client_secret") != "secret" || r.PostFormValue("audience") != "urn:pulsar" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "oauth-token", "token_type": "bearer", "expires_in": 3600})
+	})
+
+	ca := newTestCA(t)
+	attempt := newTestBroker(t, ca, "127.0.0.1").connect(t, ConnectionOptions{
+		TLSTrustCertsFile: ca.file,
+		OAuth2: &OAuth2Options{
+			IssuerURL:    issuer.URL,
+			Audience:     "urn:pulsar",
+			ClientID:     "client",
+			ClientSecret: "secret",
+		},
+	})
+	if attempt.authMethodName != "token" || attempt.authData != "oauth-token" {
+		t.Fatalf("got %+v, want token oauth-token", attempt)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+
+	// The client certificate on its own is the credential.
+	attempt := newTestBroker(t, ca, "127.0.0.1").connect(t, ConnectionOptions{TLSTrustCertsFile: ca.file, TLSCertFile: certFile, TLSKeyFile: keyFile})
+	if attempt.clientCertName != "client" || attempt.authMethodName != "tls" {
+		t.Fatalf("got %+v, want client certificate with tls authentication", attempt)
+	}
+
+	// Alongside a token it only secures the connection.
+	attempt = newTestBroker(t, ca, "127.0.0.1").connect(t, ConnectionOptions{AuthToken: "token", TLSTrustCertsFile: ca.file, TLSCertFile: certFile, TLSKeyFile: keyFile})
+	if attempt.clientCertName != "client" || attempt.authMethodName != "token" || attempt.authData != "token" {
+		t.Fatalf("got %+v, want client certificate with token authentication", attempt)
+	}
+}
+
+func TestHostnameVerification(t *testing.T) {
+	ca := newTestCA(t)
+	validate := ConnectionOptions{TLSTrustCertsFile: ca.file, TLSValidateHostname: true}
+
+	if attempt := newTestBroker(t, ca, "127.0.0.1").connect(t, validate); attempt.handshakeErr != nil {
+		t.Fatalf("certificate for the broker host rejected: %v", attempt.handshakeErr)
+	}
+	if attempt := newTestBroker(t, ca, "other.example").connect(t, validate); attempt.handshakeErr == nil {
+		t.Fatal("certificate for another host accepted with hostname validation")
+	}
+	if attempt := newTestBroker(t, ca, "other.example").connect(t, ConnectionOptions{TLSTrustCertsFile: ca.file}); attempt.handshakeErr == nil {
+		t.Fatal("certificate for another host accepted without hostname validation")
+	}
+	attempt := newTestBroker(t, ca, "other.example").connect(t, ConnectionOptions{TLSTrustCertsFile: ca.file, TLSAllowInsecureConnection: true})
+	if attempt.handshakeErr != nil || !attempt.connectCommandOK {
+		t.Fatalf("insecure connection rejected: %+v", attempt)
+	}
+}
@@ -0,0 +1,204 @@
+package pulsarClient
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// DedupStore remembers which events have already been handled successfully.
+type DedupStore interface {
+	// Seen reports whether id was marked and has not expired.
+	Seen(ctx context.Context, id string) (bool, error)
+	// Mark records id as handled for ttl.
+	Mark(ctx context.Context, id string, ttl time.Duration) error
+}
+
+// WithDeduplication skips events whose ID is already in store: duplicates are acked without
+// calling the handler, and an ID is only recorded after the handler succeeds. Concurrent
+// deliveries of the same event can still both run, so use key-ordered dispatch where that matters.
+// IDs are remembered for ttl, or 24 hours when ttl is 0 or less.
+func WithDeduplication(store DedupStore, ttl time.Duration) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		if ttl <= 0 {
+			ttl = defaultDedupTTL
+		}
+		cfg.dedupStore = store
+		cfg.dedupTTL = ttl
+	}
+}
+
+// dedupID identifies an event for deduplication: the flow-system event ID, or the message key and
+// message ID for events without one.
+func dedupID(header *EventHeader, msg pulsar.Message) string {
+	if id := eventID(header.ID); id != "" {
+		return id
+	}
+	return msg.Key() + ":" + msg.ID().String()
+}
+
+// eventID formats a flow-system event ID, or returns "" for an event without one. A missing ID is
+// the zero value of the ID type, such as "", nil or the nil UUID, and formatting it would give
+// every such event the same key.
+func eventID(id any) string {
+	value := reflect.ValueOf(id)
+	if !value.IsValid() || value.IsZero() {
+		return ""
+	}
+	return fmt.Sprint(id)
+}
+
+// MemoryDedupStore is an in-process DedupStore that keeps at most capacity IDs, evicting the
+// least recently marked first.
+type MemoryDedupStore struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type dedupEntry struct {
+	id      string
+	expires time.Time
+}
+
+// NewMemoryDedupStore creates a MemoryDedupStore holding up to capacity IDs.
+func NewMemoryDedupStore(capacity int) *MemoryDedupStore {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return &MemoryDedupStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (s *MemoryDedupStore) Seen(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, found := s.entries[id]
+	if !found {
+		return false, nil
+	}
+	if time.Now().After(element.Value.(*dedupEntry).expires) {
+		s.order.Remove(element)
+		delete(s.entries, id)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *MemoryDedupStore) Mark(_ context.Context, id string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mark(id, time.Now().Add(ttl))
+	return nil
+}
+
+func (s *MemoryDedupStore) mark(id string, expires time.Time) {
+	if element, found := s.entries[id]; found {
+		element.Value.(*dedupEntry).expires = expires
+		s.order.MoveToFront(element)
+		return
+	}
+	s.entries[id] = s.order.PushFront(&dedupEntry{id: id, expires: expires})
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*dedupEntry).id)
+	}
+}
+
+// FileDedupStore is a MemoryDedupStore whose marks are also appended to a file, so they survive
+// restarts. Expired marks are dropped when the file is loaded.
+type FileDedupStore struct {
+	*MemoryDedupStore
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileDedupStore loads the marks in path that have not expired and opens it for appending.
+func NewFileDedupStore(path string, capacity int) (*FileDedupStore, error) {
+	memory := NewMemoryDedupStore(capacity)
+
+	now := time.Now()
+	if existing, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(existing)
+		for scanner.Scan() {
+			var entry struct {
+				ID      string    `json:"id"`
+				Expires time.Time `json:"expires"`
+			}
+			if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Expires.After(now) {
+				memory.mark(entry.ID, entry.Expires)
+			}
+		}
+		existing.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read dedup file %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open dedup file %s: %w", path, err)
+	}
+
+	// Rewrite the file with only the live marks so it does not grow without bound.
+	tmpPath := path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dedup file %s: %w", tmpPath, err)
+	}
+	writer := bufio.NewWriter(tmp)
+	for element := memory.order.Back(); element != nil; element = element.Prev() {
+		entry := element.Value.(*dedupEntry)
+		line, _ := json.Marshal(map[string]any{"id": entry.id, "expires": entry.expires})
+		writer.Write(append(line, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write dedup file %s: %w", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, fmt.Errorf("failed to replace dedup file %s: %w", path, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dedup file %s: %w", path, err)
+	}
+	return &FileDedupStore{MemoryDedupStore: memory, file: file}, nil
+}
+
+func (s *FileDedupStore) Mark(ctx context.Context, id string, ttl time.Duration) error {
+	expires := time.Now().Add(ttl)
+	line, err := json.Marshal(map[string]any{"id": id, "expires": expires})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	_, err = s.file.Write(append(line, '\n'))
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to write dedup mark for %s: %w", id, err)
+	}
+	return s.MemoryDedupStore.Mark(ctx, id, ttl)
+}
+
+// Close closes the underlying file.
+func (s *FileDedupStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,273 @@
+package pulsarClient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	sysResponse "github.com/factory24/flow-system/pkg/response"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+const (
+	dlqPropertyPrefix = "original_prop_"
+
+	// dlqBrowseIdleTimeout ends a browse once the DLQ has delivered nothing for this long.
+	dlqBrowseIdleTimeout = 3 * time.Second
+)
+
+// DLQMessage is a dead-lettered message as seen by a DLQBrowser.
+type DLQMessage struct {
+	ID                pulsar.MessageID  `json:"-"`
+	MessageID         string            `json:"message_id"`
+	Reason            string            `json:"reason"`
+	ErrorDetail       string            `json:"error_detail"`
+	FailureHistory    string            `json:"failure_history,omitempty"`
+	OriginalTopic     string            `json:"original_topic"`
+	OriginalMessageID string            `json:"original_message_id"`
+	EventType         string            `json:"event_type,omitempty"`
+	Key               string            `json:"key,omitempty"`
+	OrderingKey       string            `json:"ordering_key,omitempty"`
+	EventTime         time.Time         `json:"event_time,omitzero"`
+	PublishTime       time.Time         `json:"publish_time"`
+	Properties        map[string]string `json:"properties,omitempty"`
+	Payload           []byte            `json:"-"`
+}
+
+// dlqExportRecord is a DLQMessage as written by Export: JSON payloads are embedded as-is, anything
+// else is base64-encoded.
+type dlqExportRecord struct {
+	DLQMessage
+	Payload       json.RawMessage `json:"payload,omitempty"`
+	PayloadBase64 []byte          `json:"payload_base64,omitempty"`
+}
+
+// DLQFilter selects dead-lettered messages. Empty fields match everything.
+type DLQFilter struct {
+	Reasons    []string
+	EventTypes []string
+	// From and To bound the time the message was dead-lettered.
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+func (f DLQFilter) matches(msg DLQMessage) bool {
+	if len(f.Reasons) > 0 && !slices.Contains(f.Reasons, msg.Reason) {
+		return false
+	}
+	if len(f.EventTypes) > 0 && !slices.Contains(f.EventTypes, msg.EventType) {
+		return false
+	}
+	if !f.From.IsZero() && msg.PublishTime.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && msg.PublishTime.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// DLQBrowser inspects and acts on the outstanding messages of a DLQ subscription.
+type DLQBrowser interface {
+	// List returns the messages matching filter without acknowledging them. While List runs the
+	// messages are held by the browser; they are released for redelivery when it returns.
+	List(ctx context.Context, filter DLQFilter) ([]DLQMessage, error)
+	// Replay republishes messages with their original properties to targetTopic, or to each
+	// message's original topic when targetTopic is empty, and removes them from the DLQ.
+	Replay(ctx context.Context, targetTopic string, messages ...DLQMessage) (int, error)
+	// Discard removes messages from the DLQ without republishing them.
+	Discard(ctx context.Context, messages ...DLQMessage) (int, error)
+	// Export writes messages as JSON lines to path, leaving them in the DLQ.
+	Export(ctx context.Context, path string, messages ...DLQMessage) error
+}
+
+type dlqBrowser struct {
+	client           *pulsarClient
+	topic            string
+	subscriptionName string
+}
+
+// DLQ returns a browser for dlqTopic. subscriptionName is the subscription whose backlog is
+// browsed, normally the name of the subscription that dead-lettered the messages.
+func (p *pulsarClient) DLQ(dlqTopic, subscriptionName string) DLQBrowser {
+	return &dlqBrowser{client: p, topic: dlqTopic, subscriptionName: subscriptionName}
+}
+
+func (b *dlqBrowser) subscribe() (pulsar.Consumer, error) {
+	consumer, err := b.client.active().Subscribe(pulsar.ConsumerOptions{
+		Topic:                       b.topic,
+		SubscriptionName:            b.subscriptionName,
+		Type:                        pulsar.Shared,
+		SubscriptionInitialPosition: pulsar.SubscriptionPositionEarliest,
+		Decryption: &pulsar.MessageDecryptionInfo{
+			KeyReader:                   b.client.keyReader,
+			MessageCrypto:               nil,
+			ConsumerCryptoFailureAction: 1,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to DLQ topic %s: %w", b.topic, err)
+	}
+	return consumer, nil
+}
+
+func (b *dlqBrowser) List(ctx context.Context, filter DLQFilter) ([]DLQMessage, error) {
+	consumer, err := b.subscribe()
+	if err != nil {
+		return nil, err
+	}
+	// Closing without acking hands every received message back to the subscription.
+	defer consumer.Close()
+
+	var messages []DLQMessage
+	for filter.Limit <= 0 || len(messages) < filter.Limit {
+		receiveCtx, cancel := context.WithTimeout(ctx, dlqBrowseIdleTimeout)
+		msg, err := consumer.Receive(receiveCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return messages, ctx.Err()
+			}
+			break // idle: the backlog has been read
+		}
+		if message := newDLQMessage(msg); filter.matches(message) {
+			messages = append(messages, message)
+		}
+	}
+	PulsarLogInfo("Listed %d message(s) from DLQ %s", len(messages), b.topic)
+	return messages, nil
+}
+
+func (b *dlqBrowser) Replay(ctx context.Context, targetTopic string, messages ...DLQMessage) (int, error) {
+	consumer, err := b.subscribe()
+	if err != nil {
+		return 0, err
+	}
+	defer consumer.Close()
+
+	replayed := 0
+	var errs []error
+	for _, message := range messages {
+		topic := targetTopic
+		if topic == "" {
+			topic = message.OriginalTopic
+		}
+		producer, err := b.client.GetOrCreateProducer(topic)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get producer for topic %s: %w", topic, err))
+			continue
+		}
+		if _, err := producer.Send(ctx, &pulsar.ProducerMessage{
+			Payload:     message.Payload,
+			Key:         message.Key,
+			OrderingKey: message.OrderingKey,
+			EventTime:   message.EventTime,
+			Properties:  message.Properties,
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to replay message %s to %s: %w", message.MessageID, topic, err))
+			continue
+		}
+		if err := consumer.AckID(message.ID); err != nil {
+			errs = append(errs, fmt.Errorf("replayed message %s but failed to remove it from the DLQ: %w", message.MessageID, err))
+			continue
+		}
+		PulsarLogSuccess("Replayed DLQ message %s to %s", message.MessageID, topic)
+		replayed++
+	}
+	return replayed, errors.Join(errs...)
+}
+
+func (b *dlqBrowser) Discard(_ context.Context, messages ...DLQMessage) (int, error) {
+	consumer, err := b.subscribe()
+	if err != nil {
+		return 0, err
+	}
+	defer consumer.Close()
+
+	discarded := 0
+	var errs []error
+	for _, message := range messages {
+		if err := consumer.AckID(message.ID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to discard DLQ message %s: %w", message.MessageID, err))
+			continue
+		}
+		discarded++
+	}
+	PulsarLogInfo("Discarded %d message(s) from DLQ %s", discarded, b.topic)
+	return discarded, errors.Join(errs...)
+}
+
+func (b *dlqBrowser) Export(_ context.Context, path string, messages ...DLQMessage) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create DLQ export %s: %w", path, err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, message := range messages {
+		record := dlqExportRecord{DLQMessage: message}
+		if json.Valid(message.Payload) {
+			record.Payload = message.Payload
+		} else {
+			record.PayloadBase64 = message.Payload
+		}
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("failed to export DLQ message %s: %w", message.MessageID, err)
+		}
+	}
+	PulsarLogInfo("Exported %d message(s) from DLQ %s to %s", len(messages), b.topic, path)
+	return file.Sync()
+}
+
+// newDLQMessage decodes the metadata sendToDLQ attached to a dead-lettered message.
+func newDLQMessage(msg pulsar.Message) DLQMessage {
+	properties := msg.Properties()
+	message := DLQMessage{
+		ID:                msg.ID(),
+		MessageID:         msg.ID().String(),
+		Reason:            properties["dlq_reason"],
+		ErrorDetail:       properties["dlq_error_detail"],
+		FailureHistory:    properties["dlq_failure_history"],
+		OriginalTopic:     properties["original_topic"],
+		OriginalMessageID: properties["original_message_id"],
+		Key:               msg.Key(),
+		OrderingKey:       msg.OrderingKey(),
+		EventTime:         msg.EventTime(),
+		PublishTime:       msg.PublishTime(),
+		Properties:        restoreOriginalProperties(properties),
+		Payload:           msg.Payload(),
+	}
+	if message.OriginalTopic == "" {
+		message.OriginalTopic = strings.TrimSuffix(baseTopic(msg.Topic()), defaultDLQSuffix)
+	}
+	if header, err := sysResponse.ParseEventHeader(msg.Payload()); err == nil {
+		message.EventType = header.EventType
+	}
+	return message
+}
+
+// restoreOriginalProperties returns the properties the message had before it was dead-lettered.
+// Retry bookkeeping is dropped so a replayed message starts a fresh retry schedule.
+func restoreOriginalProperties(properties map[string]string) map[string]string {
+	restored := make(map[string]string)
+	for k, v := range properties {
+		name, found := strings.CutPrefix(k, dlqPropertyPrefix)
+		if !found {
+			continue
+		}
+		switch name {
+		case retryCountProperty, retryTopicProperty, retryHistoryProperty:
+			continue
+		}
+		restored[name] = v
+	}
+	return restored
+}
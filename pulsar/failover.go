@@ -0,0 +1,269 @@
+package pulsarClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+const (
+	defaultProbeInterval     = 10 * time.Second
+	defaultProbeTimeout      = 3 * time.Second
+	defaultFailureThreshold  = 3
+	defaultRecoveryThreshold = 6
+)
+
+// FailoverOptions tunes how the client watches its clusters. Every ProbeInterval the active
+// cluster is probed; after FailureThreshold failed probes in a row the client switches to the
+// first healthy cluster, primary first. While a backup is active the primary is probed too, and
+// the client switches back after RecoveryThreshold successful probes in a row.
+//
+// Subscriptions are recreated on the new cluster with the same name. For them to resume where
+// they left off, the clusters must geo-replicate the topics with replicated subscriptions.
+type FailoverOptions struct {
+	// ProbeInterval defaults to 10 seconds. PULSAR.FAILOVER.PROBE.INTERVAL.
+	ProbeInterval time.Duration
+	// ProbeTimeout bounds each probe and defaults to 3 seconds.
+	ProbeTimeout time.Duration
+	// FailureThreshold defaults to 3.
+	FailureThreshold int
+	// RecoveryThreshold defaults to 6, so a flapping primary is not switched back to too eagerly.
+	RecoveryThreshold int
+	// Probe checks that a service URL is reachable. By default it opens a TCP connection to one of
+	// the URL's hosts.
+	Probe func(ctx context.Context, serviceURL string) error
+}
+
+// FailoverEvent describes a switch from one cluster to another.
+type FailoverEvent struct {
+	From   string
+	To     string
+	Reason string
+	Time   time.Time
+	// Err is set when the switch failed and the client stayed on From.
+	Err error
+}
+
+// WithFailoverListener calls listener whenever the client switches clusters, or fails to.
+// It is called synchronously from the health monitor and should return quickly.
+func WithFailoverListener(listener func(FailoverEvent)) ClientOption {
+	return func(p *pulsarClient) {
+		p.failoverListener = listener
+	}
+}
+
+// withDefaults returns o with unset fields defaulted.
+func (o FailoverOptions) withDefaults() FailoverOptions {
+	if o.ProbeInterval <= 0 {
+		o.ProbeInterval = defaultProbeInterval
+	}
+	if o.ProbeTimeout <= 0 {
+		o.ProbeTimeout = defaultProbeTimeout
+	}
+	if o.FailureThreshold <= 0 {
+		o.FailureThreshold = defaultFailureThreshold
+	}
+	if o.RecoveryThreshold <= 0 {
+		o.RecoveryThreshold = defaultRecoveryThreshold
+	}
+	if o.Probe == nil {
+		o.Probe = probeServiceURL
+	}
+	return o
+}
+
+// probeServiceURL dials the hosts of a service URL such as pulsar://a:6650,b:6650 until one accepts
+// a TCP connection.
+func probeServiceURL(ctx context.Context, serviceURL string) error {
+	parsed, err := url.Parse(serviceURL)
+	if err != nil {
+		return fmt.Errorf("invalid service URL %s: %w", serviceURL, err)
+	}
+	var dialer net.Dialer
+	var errs []error
+	for _, host := range strings.Split(parsed.Host, ",") {
+		conn, err := dialer.DialContext(ctx, "tcp", host)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("cluster %s unreachable: %w", serviceURL, errors.Join(errs...))
+}
+
+// active returns the Pulsar client of the cluster currently in use.
+func (p *pulsarClient) active() pulsar.Client {
+	p.clientMu.RLock()
+	defer p.clientMu.RUnlock()
+	return p.client
+}
+
+// ActiveURL returns the service URL of the cluster the client is currently using.
+func (p *pulsarClient) ActiveURL() string {
+	p.clientMu.RLock()
+	defer p.clientMu.RUnlock()
+	return p.url
+}
+
+// monitorClusters probes the clusters until ctx ends, switching as described on FailoverOptions.
+func (p *pulsarClient) monitorClusters(ctx context.Context, primary string, backups []string, options FailoverOptions) {
+	ticker := time.NewTicker(options.ProbeInterval)
+	defer ticker.Stop()
+
+	probe := func(serviceURL string) error {
+		probeCtx, cancel := context.WithTimeout(ctx, options.ProbeTimeout)
+		defer cancel()
+		return options.Probe(probeCtx, serviceURL)
+	}
+
+	failures, recoveries := 0, 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		p.retryStale()
+		current := p.ActiveURL()
+		if current != primary {
+			if probe(primary) == nil {
+				recoveries++
+			} else {
+				recoveries = 0
+			}
+			if recoveries >= options.RecoveryThreshold {
+				recoveries = 0
+				if p.switchCluster(primary, "primary cluster recovered") == nil {
+					failures = 0
+					continue
+				}
+			}
+		}
+
+		err := probe(current)
+		if err == nil {
+			failures = 0
+			continue
+		}
+		failures++
+		PulsarLogError("Health probe of cluster %s failed (%d/%d): %v", current, failures, options.FailureThreshold, err)
+		if failures < options.FailureThreshold {
+			continue
+		}
+
+		for _, candidate := range append([]string{primary}, backups...) {
+			if candidate == current || probe(candidate) != nil {
+				continue
+			}
+			if p.switchCluster(candidate, fmt.Sprintf("cluster %s failed %d health probes: %v", current, failures, err)) == nil {
+				failures, recoveries = 0, 0
+				break
+			}
+		}
+	}
+}
+
+// switchCluster moves the client to serviceURL. Cached producers are closed and recreated on first
+// use, every active subscription is resubscribed on the new cluster feeding the same workers, and
+// the reply listener is dropped so the next Request subscribes again.
+func (p *pulsarClient) switchCluster(serviceURL, reason string) error {
+	event := FailoverEvent{From: p.ActiveURL(), To: serviceURL, Reason: reason, Time: time.Now()}
+	defer func() {
+		if p.failoverListener != nil {
+			p.failoverListener(event)
+		}
+	}()
+
+	clientOptions, err := p.connection.clientOptions(serviceURL)
+	if err == nil {
+		var client pulsar.Client
+		if client, err = pulsar.NewClient(clientOptions); err == nil {
+			err = p.adoptClient(client, serviceURL)
+		}
+	}
+	if err != nil {
+		event.Err = err
+		PulsarLogError("Failed to switch from cluster %s to %s: %v", event.From, serviceURL, err)
+		return err
+	}
+	p.metrics.clusterSwitched(serviceURL)
+	PulsarLogSuccess("Switched from cluster %s to %s (%s)", event.From, serviceURL, reason)
+	return nil
+}
+
+// adoptClient makes client the active client and moves producers, subscriptions and the reply
+// listener over to it before closing the previous client. Only a client already shut down is an
+// error; subscriptions that cannot move yet are retried later.
+func (p *pulsarClient) adoptClient(client pulsar.Client, serviceURL string) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		client.Close()
+		return ErrClientClosed
+	}
+	producers := p.producers
+	subscriptions := append([]*subscription(nil), p.subscriptions...)
+	p.clientMu.Lock()
+	previous := p.client
+	p.client, p.url = client, serviceURL
+	p.clientMu.Unlock()
+	p.producers = make(map[string]pulsar.Producer)
+	p.dlqReady = make(map[string]bool)
+	p.mu.Unlock()
+
+	for topic, producer := range producers {
+		producer.Close()
+		PulsarLogInfo("Closed producer for topic %s on cluster switch", topic)
+	}
+
+	p.replyMu.Lock()
+	if p.replyListener != nil {
+		p.replyListener.close()
+		p.replyListener = nil
+	}
+	p.replyMu.Unlock()
+	p.replyProducers.closeAll()
+
+	p.resubscribe(client, serviceURL, subscriptions)
+
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// resubscribe moves subscriptions to client. A subscription that fails is left stale and retried
+// by retryStale on the next health probe.
+func (p *pulsarClient) resubscribe(client pulsar.Client, serviceURL string, subscriptions []*subscription) {
+	for _, sub := range subscriptions {
+		if err := sub.resubscribe(client); err != nil {
+			PulsarLogError("Failed to resubscribe %s on cluster %s, will retry: %v", sub.name, serviceURL, err)
+			continue
+		}
+		PulsarLogSuccess("Resubscribed %s on cluster %s", sub.name, serviceURL)
+	}
+}
+
+// retryStale resubscribes the subscriptions whose resubscribe failed after the last switch.
+func (p *pulsarClient) retryStale() {
+	p.clientMu.RLock()
+	client, serviceURL := p.client, p.url
+	p.clientMu.RUnlock()
+	p.mu.RLock()
+	var stale []*subscription
+	for _, sub := range p.subscriptions {
+		if sub.needsResubscribe() {
+			stale = append(stale, sub)
+		}
+	}
+	p.mu.RUnlock()
+	p.resubscribe(client, serviceURL, stale)
+}
@@ -0,0 +1,182 @@
+package pulsarClient
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/time/rate"
+)
+
+// Subscription is the handle of a subscription started by ListenOnTopics or ListenOnPattern.
+type Subscription interface {
+	// Name returns the subscription name.
+	Name() string
+	// Pause stops handing messages to the handler, e.g. while a downstream system is down. Messages
+	// already received wait in memory and the consumer stops fetching once its buffer is full; the
+	// subscription stays connected, so no rebalancing happens.
+	Pause()
+	// Resume continues a paused subscription.
+	Resume()
+	// Paused reports whether the subscription is paused.
+	Paused() bool
+	// SetRateLimit limits handler calls across all workers to eventsPerSecond, with bursts of up
+	// to burst events. A limit of 0 or less removes the limit.
+	SetRateLimit(eventsPerSecond float64, burst int)
+	// SetWorkerCount starts or stops workers until workers of them are running. Stopped workers
+	// finish the event they are handling first. A key-ordered subscription first lets its workers
+	// handle every event already routed to them and then spreads the keys over the new workers,
+	// so it blocks while the subscription is paused.
+	SetWorkerCount(workers int) error
+	// WorkerCount returns the number of workers.
+	WorkerCount() int
+}
+
+// WithRateLimit starts the subscription with a rate limit; see Subscription.SetRateLimit.
+func WithRateLimit(eventsPerSecond float64, burst int) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		cfg.rateLimit = eventsPerSecond
+		cfg.rateBurst = burst
+	}
+}
+
+// newLimiter returns a limiter for eventsPerSecond, unlimited when it is 0 or less.
+func newLimiter(eventsPerSecond float64, burst int) *rate.Limiter {
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	setLimit(limiter, eventsPerSecond, burst)
+	return limiter
+}
+
+func setLimit(limiter *rate.Limiter, eventsPerSecond float64, burst int) {
+	if eventsPerSecond <= 0 {
+		limiter.SetLimit(rate.Inf)
+		return
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	limiter.SetBurst(burst)
+	limiter.SetLimit(rate.Limit(eventsPerSecond))
+}
+
+func (s *subscription) Name() string {
+	return s.name
+}
+
+func (s *subscription) Pause() {
+	s.flowMu.Lock()
+	defer s.flowMu.Unlock()
+	if s.paused {
+		return
+	}
+	s.paused = true
+	s.resumed = make(chan struct{})
+	PulsarLogInfo("Subscription %s paused", s.name)
+}
+
+func (s *subscription) Resume() {
+	s.flowMu.Lock()
+	defer s.flowMu.Unlock()
+	if !s.paused {
+		return
+	}
+	s.paused = false
+	close(s.resumed)
+	PulsarLogInfo("Subscription %s resumed", s.name)
+}
+
+func (s *subscription) Paused() bool {
+	s.flowMu.Lock()
+	defer s.flowMu.Unlock()
+	return s.paused
+}
+
+func (s *subscription) SetRateLimit(eventsPerSecond float64, burst int) {
+	setLimit(s.limiter, eventsPerSecond, burst)
+	if eventsPerSecond <= 0 {
+		PulsarLogInfo("Subscription %s rate limit removed", s.name)
+	} else {
+		PulsarLogInfo("Subscription %s rate limited to %.2f events/s (burst %d)", s.name, eventsPerSecond, burst)
+	}
+}
+
+func (s *subscription) SetWorkerCount(workers int) error {
+	if workers < 1 {
+		return fmt.Errorf("invalid worker count %d for subscription %s", workers, s.name)
+	}
+	if s.cfg.keyOrdered {
+		return s.resize(workers)
+	}
+
+	s.flowMu.Lock()
+	defer s.flowMu.Unlock()
+	if s.ctx.Err() != nil {
+		return fmt.Errorf("subscription %s is stopped: %w", s.name, s.ctx.Err())
+	}
+	for len(s.stops) < workers {
+		s.startWorker()
+	}
+	for len(s.stops) > workers {
+		last := len(s.stops) - 1
+		close(s.stops[last])
+		s.stops = s.stops[:last]
+	}
+	PulsarLogInfo("Subscription %s scaled to %d workers", s.name, workers)
+	return nil
+}
+
+func (s *subscription) WorkerCount() int {
+	s.flowMu.Lock()
+	defer s.flowMu.Unlock()
+	if s.cfg.keyOrdered {
+		return s.lanes
+	}
+	return len(s.stops)
+}
+
+// resize has the dispatcher of a key-ordered subscription rebuild its lanes for workers workers.
+func (s *subscription) resize(workers int) error {
+	r := resize{workers: workers, done: make(chan struct{})}
+	select {
+	case s.resizes <- r:
+	case <-s.ctx.Done():
+		return fmt.Errorf("subscription %s is stopped: %w", s.name, s.ctx.Err())
+	}
+	select {
+	case <-r.done:
+	case <-s.ctx.Done():
+		return fmt.Errorf("subscription %s is stopped: %w", s.name, s.ctx.Err())
+	}
+	PulsarLogInfo("Subscription %s scaled to %d key-ordered workers", s.name, workers)
+	return nil
+}
+
+// startWorker adds a worker on the shared queue. The caller holds flowMu.
+func (s *subscription) startWorker() {
+	stop := make(chan struct{})
+	s.stops = append(s.stops, stop)
+	s.workers.Add(1)
+	go s.client.runWorker(s.ctx, s, s.queues[0], stop)
+}
+
+// waitTurn blocks while the subscription is paused and then until the rate limit allows another
+// event. It returns an error when ctx ends first.
+func (s *subscription) waitTurn(ctx context.Context) error {
+	s.flowMu.Lock()
+	resumed := s.resumed
+	s.flowMu.Unlock()
+	select {
+	case <-resumed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.limiter.Wait(ctx)
+}
+
+// closedChannel is the resumed channel of a subscription that is not paused.
+func closedChannel() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+var _ Subscription = (*subscription)(nil)
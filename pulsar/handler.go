@@ -0,0 +1,204 @@
+package pulsarClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// MessageHandler is an optional extension of EventHandler for handlers that need the message
+// metadata or explicit control over acknowledgement. When a handler implements it, HandleMessage
+// is called instead of HandleEventContext and HandleEvent.
+type MessageHandler interface {
+	EventHandler
+	HandleMessage(mc *MessageContext, header *EventHeader) Outcome
+}
+
+// MessageHandlerFunc adapts a function to a MessageHandler. Called through HandleEvent, outside of
+// a subscription, its MessageContext carries no message.
+type MessageHandlerFunc func(mc *MessageContext, header *EventHeader) Outcome
+
+// HandleEvent implements EventHandler.
+func (f MessageHandlerFunc) HandleEvent(header *EventHeader) error {
+	return f(newMessageContext(context.Background(), nil), header).Err()
+}
+
+// HandleMessage implements MessageHandler.
+func (f MessageHandlerFunc) HandleMessage(mc *MessageContext, header *EventHeader) Outcome {
+	return f(mc, header)
+}
+
+// MessageContext is the context of the message being handled. It can be passed on wherever a
+// context.Context is expected, including Reply, ScheduledTime and EventPayload.
+type MessageContext struct {
+	context.Context
+	msg pulsar.Message
+}
+
+// newMessageContext attaches msg, which may be nil, to ctx.
+func newMessageContext(ctx context.Context, msg pulsar.Message) *MessageContext {
+	if msg != nil {
+		ctx = withMessage(ctx, msg)
+	}
+	return &MessageContext{Context: ctx, msg: msg}
+}
+
+// Message returns the underlying Pulsar message, or nil.
+func (mc *MessageContext) Message() pulsar.Message {
+	return mc.msg
+}
+
+// Topic returns the topic the event was published to, looking through partitions and retry topics.
+func (mc *MessageContext) Topic() string {
+	if mc.msg == nil {
+		return ""
+	}
+	return sourceTopic(mc.msg)
+}
+
+// MessageID returns the ID of the message, or nil.
+func (mc *MessageContext) MessageID() pulsar.MessageID {
+	if mc.msg == nil {
+		return nil
+	}
+	return mc.msg.ID()
+}
+
+// Key returns the message key.
+func (mc *MessageContext) Key() string {
+	if mc.msg == nil {
+		return ""
+	}
+	return mc.msg.Key()
+}
+
+// OrderingKey returns the ordering key, or the message key when none was set.
+func (mc *MessageContext) OrderingKey() string {
+	if mc.msg == nil {
+		return ""
+	}
+	return messageOrderingKey(mc.msg)
+}
+
+// Property returns a single message property.
+func (mc *MessageContext) Property(name string) string {
+	return mc.Properties()[name]
+}
+
+// Properties returns the message properties. The map must not be modified.
+func (mc *MessageContext) Properties() map[string]string {
+	if mc.msg == nil {
+		return nil
+	}
+	return mc.msg.Properties()
+}
+
+// PublishTime returns when the message was published.
+func (mc *MessageContext) PublishTime() time.Time {
+	if mc.msg == nil {
+		return time.Time{}
+	}
+	return mc.msg.PublishTime()
+}
+
+// EventTime returns the application-defined event time, or the zero time when none was set.
+func (mc *MessageContext) EventTime() time.Time {
+	if mc.msg == nil {
+		return time.Time{}
+	}
+	return mc.msg.EventTime()
+}
+
+// RedeliveryCount returns how many times the broker has redelivered the message after a nack.
+func (mc *MessageContext) RedeliveryCount() uint32 {
+	if mc.msg == nil {
+		return 0
+	}
+	return mc.msg.RedeliveryCount()
+}
+
+// EventVersion returns the payload version the event was published with. The payload handed to
+// the handler has already been upcast to the latest version.
+func (mc *MessageContext) EventVersion() int {
+	if mc.msg == nil {
+		return 1
+	}
+	return MessageEventVersion(mc.msg)
+}
+
+// RetryCount returns how many times the event has been through the retry topic.
+func (mc *MessageContext) RetryCount() int {
+	if mc.msg == nil {
+		return 0
+	}
+	return retryCount(mc.msg)
+}
+
+// Outcome tells the subscription what to do with a message once its MessageHandler returns.
+type Outcome struct {
+	err error
+}
+
+// Ack acknowledges the message.
+func Ack() Outcome {
+	return Outcome{}
+}
+
+// Nack reports a failure, exactly as if HandleEvent had returned err: the message goes through the
+// retry schedule or is nacked, and is dead-lettered once the delivery limit is reached.
+func Nack(err error) Outcome {
+	if err == nil {
+		err = errors.New("nacked by handler")
+	}
+	return Outcome{err: err}
+}
+
+// NackAfter is Nack with the redelivery delayed by at least delay. With WithRetrySchedule the
+// event is sent through the retry topic with delay in place of the scheduled one; otherwise the
+// nack itself is held back for delay, on top of the subscription's nack redelivery delay.
+func NackAfter(delay time.Duration, err error) Outcome {
+	if err == nil {
+		err = errors.New("nacked by handler")
+	}
+	return Outcome{err: &nackAfterError{delay: delay, err: err}}
+}
+
+// DeadLetter sends the message straight to the DLQ with reason, without further redeliveries.
+func DeadLetter(reason string, err error) Outcome {
+	if err == nil {
+		err = errors.New("dead-lettered by handler")
+	}
+	return Outcome{err: &deadLetterError{reason: reason, err: err}}
+}
+
+// Err returns the outcome as the error HandleEvent would have returned, nil for Ack. Use
+// DeadLetterReason and NackDelay to tell the outcomes apart.
+func (o Outcome) Err() error {
+	return o.err
+}
+
+// nackAfterError tells processMessage to delay the redelivery of a message.
+type nackAfterError struct {
+	delay time.Duration
+	err   error
+}
+
+func (e *nackAfterError) Error() string {
+	return fmt.Sprintf("nack after %s: %v", e.delay, e.err)
+}
+
+func (e *nackAfterError) Unwrap() error {
+	return e.err
+}
+
+// NackDelay reports whether a handler error asks for a delayed redelivery, and after how long.
+func NackDelay(err error) (time.Duration, bool) {
+	var nackErr *nackAfterError
+	if errors.As(err, &nackErr) {
+		return nackErr.delay, true
+	}
+	return 0, false
+}
@@ -0,0 +1,90 @@
+// Package dispatch holds the parts of event delivery that the pulsartest fake shares with the
+// client, so the fake hands events to handlers exactly as a subscription does.
+package dispatch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	sysResponse "github.com/factory24/flow-system/pkg/response"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+const (
+	// ReplyToProperty names the topic a request expects its reply on.
+	ReplyToProperty = "reply-to"
+	// CorrelationIDProperty ties a reply to the request it answers.
+	CorrelationIDProperty = "correlation-id"
+)
+
+// Handle calls the richest method handler implements for an event parsed from msg, and returns
+// the outcome as an error. The handler interfaces are declared by the client package, which sets
+// Handle when it is initialised.
+var Handle func(ctx context.Context, handler any, msg pulsar.Message, header *sysResponse.EventHeader) error
+
+type messageKey struct{}
+
+type payloadKey struct{}
+
+// WithMessage attaches the message being handled to ctx.
+func WithMessage(ctx context.Context, msg pulsar.Message) context.Context {
+	return context.WithValue(ctx, messageKey{}, msg)
+}
+
+// Message returns the message being handled, or nil outside of a handler.
+func Message(ctx context.Context) pulsar.Message {
+	msg, _ := ctx.Value(messageKey{}).(pulsar.Message)
+	return msg
+}
+
+// WithPayload attaches a payload decoded by a topic schema to ctx.
+func WithPayload(ctx context.Context, payload any) context.Context {
+	return context.WithValue(ctx, payloadKey{}, payload)
+}
+
+// Payload returns the payload attached with WithPayload, or nil.
+func Payload(ctx context.Context) any {
+	return ctx.Value(payloadKey{})
+}
+
+// QualifiedTopic expands a short topic name to the persistent://tenant/namespace/topic form the
+// broker reports for received messages.
+func QualifiedTopic(topic string) string {
+	switch {
+	case strings.Contains(topic, "://"):
+		return topic
+	case strings.Contains(topic, "/"):
+		return "persistent://" + topic
+	default:
+		return "persistent://public/default/" + topic
+	}
+}
+
+// NewCorrelationID returns a random ID for matching a reply to its request.
+func NewCorrelationID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
+
+// RequestProperties returns the properties that turn an event into a request answered on replyTo.
+func RequestProperties(replyTo, correlationID string) map[string]string {
+	return map[string]string{
+		ReplyToProperty:       replyTo,
+		CorrelationIDProperty: correlationID,
+	}
+}
+
+// ReplyProperties returns the property that marks an event as the reply to correlationID.
+func ReplyProperties(correlationID string) map[string]string {
+	return map[string]string{
+		CorrelationIDProperty: correlationID,
+	}
+}
@@ -0,0 +1,254 @@
+package pulsarClient
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/apache/pulsar-client-go/pulsar/crypto"
+)
+
+// MemoryKeyReader is a crypto.KeyReader that serves named key pairs from memory. Several keys can
+// be loaded at once, so after a rotation producers encrypt with the new key while consumers can
+// still decrypt messages encrypted with the old ones.
+//
+// Keys may be RSA (PKCS#1 or PKCS#8) or EC (SEC 1 or PKCS#8) in PEM form. They are normalised to
+// what the Pulsar client expects: PKIX public keys, and PKCS#1 (RSA) or SEC 1 (EC) private keys.
+// The default Pulsar message crypto only supports RSA; EC keys need a custom MessageCrypto.
+type MemoryKeyReader struct {
+	mu      sync.RWMutex
+	public  map[string][]byte
+	private map[string][]byte
+}
+
+var _ crypto.KeyReader = (*MemoryKeyReader)(nil)
+
+// NewMemoryKeyReader creates an empty MemoryKeyReader.
+func NewMemoryKeyReader() *MemoryKeyReader {
+	return &MemoryKeyReader{
+		public:  make(map[string][]byte),
+		private: make(map[string][]byte),
+	}
+}
+
+// AddKey loads the key pair called name, replacing any previous key of that name. Either PEM may be
+// empty: producers only need the public key and consumers only the private key. A missing public
+// key is derived from the private key.
+func (r *MemoryKeyReader) AddKey(name string, publicPEM, privatePEM []byte) error {
+	if name == "" {
+		return errors.New("encryption key name is empty")
+	}
+	if len(publicPEM) == 0 && len(privatePEM) == 0 {
+		return fmt.Errorf("no key material given for encryption key %s", name)
+	}
+
+	var public, private []byte
+	if len(privatePEM) > 0 {
+		key, err := parsePrivateKey(privatePEM)
+		if err != nil {
+			return fmt.Errorf("invalid private key for encryption key %s: %w", name, err)
+		}
+		if private, err = encodePrivateKey(key); err != nil {
+			return fmt.Errorf("invalid private key for encryption key %s: %w", name, err)
+		}
+		if len(publicPEM) == 0 {
+			if public, err = encodePublicKey(key.Public()); err != nil {
+				return fmt.Errorf("failed to derive public key for encryption key %s: %w", name, err)
+			}
+		}
+	}
+	if len(publicPEM) > 0 {
+		key, err := parsePublicKey(publicPEM)
+		if err != nil {
+			return fmt.Errorf("invalid public key for encryption key %s: %w", name, err)
+		}
+		if public, err = encodePublicKey(key); err != nil {
+			return fmt.Errorf("invalid public key for encryption key %s: %w", name, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.public, name)
+	delete(r.private, name)
+	if public != nil {
+		r.public[name] = public
+	}
+	if private != nil {
+		r.private[name] = private
+	}
+	return nil
+}
+
+// RemoveKey forgets the key pair called name, e.g. once no message encrypted with it is retained.
+func (r *MemoryKeyReader) RemoveKey(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.public, name)
+	delete(r.private, name)
+}
+
+// KeyNames returns the names of the loaded keys.
+func (r *MemoryKeyReader) KeyNames() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var names []string
+	for name := range r.public {
+		names = append(names, name)
+	}
+	for name := range r.private {
+		if _, found := r.public[name]; !found {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (r *MemoryKeyReader) PublicKey(keyName string, metadata map[string]string) (*crypto.EncryptionKeyInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, found := r.public[keyName]
+	if !found {
+		return nil, fmt.Errorf("no public key loaded for encryption key %s", keyName)
+	}
+	return crypto.NewEncryptionKeyInfo(keyName, key, metadata), nil
+}
+
+func (r *MemoryKeyReader) PrivateKey(keyName string, metadata map[string]string) (*crypto.EncryptionKeyInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, found := r.private[keyName]
+	if !found {
+		return nil, fmt.Errorf("no private key loaded for encryption key %s", keyName)
+	}
+	return crypto.NewEncryptionKeyInfo(keyName, key, metadata), nil
+}
+
+// decodePEM decodes the first PEM block of data. Keys taken from environment variables often
+// have their line breaks escaped as \n, so those are restored first.
+func decodePEM(data []byte) (*pem.Block, error) {
+	block, _ := pem.Decode([]byte(strings.ReplaceAll(string(data), `\n`, "\n")))
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	return block, nil
+}
+
+func parsePrivateKey(data []byte) (gocrypto.Signer, error) {
+	block, err := decodePEM(data)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("not a PKCS#1, PKCS#8 or EC private key")
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+func parsePublicKey(data []byte) (gocrypto.PublicKey, error) {
+	block, err := decodePEM(data)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("not a PKIX or PKCS#1 public key")
+}
+
+func encodePrivateKey(key gocrypto.Signer) ([]byte, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), nil
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+func encodePublicKey(key gocrypto.PublicKey) ([]byte, error) {
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// keyReaderFromEnv builds a MemoryKeyReader from the environment. PULSAR.ENCRYPTION.KEY names the
+// single key new messages are encrypted with, and PULSAR.PUBKEY and PULSAR.PRIVKEY hold its key
+// pair; encrypting with several keys needs WithKeyReader. Retired keys that must still decrypt are
+// listed in PULSAR.DECRYPTION.KEYS, each with its private key in PULSAR.PRIVKEY.<name>. It returns
+// a nil reader when encryption is not configured.
+func keyReaderFromEnv() (*MemoryKeyReader, []string, error) {
+	encKeyName := strings.TrimSpace(os.Getenv("PULSAR.ENCRYPTION.KEY"))
+	pubKey := os.Getenv("PULSAR.PUBKEY")
+	privKey := os.Getenv("PULSAR.PRIVKEY")
+	if encKeyName == "" || pubKey == "" && privKey == "" {
+		return nil, nil, nil
+	}
+	if strings.Contains(encKeyName, ",") {
+		return nil, nil, fmt.Errorf("PULSAR.ENCRYPTION.KEY must name a single key, got %q", encKeyName)
+	}
+
+	reader := NewMemoryKeyReader()
+	if err := reader.AddKey(encKeyName, []byte(pubKey), []byte(privKey)); err != nil {
+		return nil, nil, err
+	}
+	for _, name := range splitList(os.Getenv("PULSAR.DECRYPTION.KEYS")) {
+		privKey := os.Getenv("PULSAR.PRIVKEY." + name)
+		if privKey == "" {
+			return nil, nil, fmt.Errorf("PULSAR.PRIVKEY.%s environment variable not set", name)
+		}
+		if err := reader.AddKey(name, nil, []byte(privKey)); err != nil {
+			return nil, nil, err
+		}
+	}
+	return reader, []string{encKeyName}, nil
+}
+
+// splitList splits a comma-separated environment value, dropping blanks.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if trimmed := strings.TrimSpace(item); trimmed != "" {
+			items = append(items, trimmed)
+		}
+	}
+	return items
+}
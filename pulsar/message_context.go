@@ -0,0 +1,35 @@
+package pulsarClient
+
+import (
+	"context"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+
+	"github.com/factory24/athari-thirdparty/pulsar/internal/dispatch"
+)
+
+// withMessage attaches the message being handled to ctx.
+func withMessage(ctx context.Context, msg pulsar.Message) context.Context {
+	return dispatch.WithMessage(ctx, msg)
+}
+
+// messageFromContext returns the message being handled, or nil outside of a handler.
+func messageFromContext(ctx context.Context) pulsar.Message {
+	return dispatch.Message(ctx)
+}
+
+// MessageTopic returns the topic the event being handled was published to, looking through
+// partitions and retry topics, or "" outside of a handler.
+func MessageTopic(ctx context.Context) string {
+	if msg := messageFromContext(ctx); msg != nil {
+		return sourceTopic(msg)
+	}
+	return ""
+}
+
+// EventPayload returns the payload of the event being handled as decoded by its topic's Schema,
+// or false when the topic has no schema.
+func EventPayload(ctx context.Context) (any, bool) {
+	payload := dispatch.Payload(ctx)
+	return payload, payload != nil
+}
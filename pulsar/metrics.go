@@ -0,0 +1,189 @@
+package pulsarClient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "pulsar"
+
+// Metrics holds the Prometheus collectors of one or more clients. It implements
+// prometheus.Collector, so it can be registered on any registry:
+//
+//	metrics := pulsarClient.NewMetrics()
+//	registry.MustRegister(metrics)
+//	client := pulsarClient.NewPulsarClient(pulsarClient.WithMetrics(metrics))
+type Metrics struct {
+	publishAttempts     *prometheus.CounterVec
+	publishFailures     *prometheus.CounterVec
+	handlerDuration     *prometheus.HistogramVec
+	acks                *prometheus.CounterVec
+	nacks               *prometheus.CounterVec
+	dlqSends            *prometheus.CounterVec
+	producerRecreations *prometheus.CounterVec
+	clusterSwitches     *prometheus.CounterVec
+	queueDepth          *prometheus.Desc
+
+	mu     sync.Mutex
+	queues map[*subscription]struct{}
+}
+
+// NewMetrics creates unregistered collectors.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		publishAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "publish_attempts_total",
+			Help:      "Send attempts by topic, event type and outcome (success or error), including retries.",
+		}, []string{"topic", "event_type", "outcome"}),
+		publishFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "publish_failures_total",
+			Help:      "Events that could not be published after all retries, or were rejected before sending.",
+		}, []string{"topic", "event_type"}),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "handler_duration_seconds",
+			Help:      "Event handler duration by topic, event type and outcome (success, error or dead_letter).",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"topic", "event_type", "outcome"}),
+		acks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "acks_total",
+			Help:      "Messages acknowledged by topic and subscription.",
+		}, []string{"topic", "subscription"}),
+		nacks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "nacks_total",
+			Help:      "Messages negatively acknowledged by topic and subscription.",
+		}, []string{"topic", "subscription"}),
+		dlqSends: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "dlq_sends_total",
+			Help:      "Messages sent to a DLQ by source topic, reason and outcome (success or error).",
+		}, []string{"topic", "reason", "outcome"}),
+		producerRecreations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "producer_recreations_total",
+			Help:      "Cached producers discarded after a failure so the next publish recreates them.",
+		}, []string{"topic"}),
+		clusterSwitches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cluster_switches_total",
+			Help:      "Failovers by the service URL of the cluster switched to.",
+		}, []string{"to"}),
+		queueDepth: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "worker_queue_depth"),
+			"Messages received but not yet picked up by a worker, by subscription.",
+			[]string{"subscription"}, nil,
+		),
+		queues: make(map[*subscription]struct{}),
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.publishAttempts, m.publishFailures, m.handlerDuration,
+		m.acks, m.nacks, m.dlqSends, m.producerRecreations, m.clusterSwitches,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range m.collectors() {
+		collector.Describe(ch)
+	}
+	ch <- m.queueDepth
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, collector := range m.collectors() {
+		collector.Collect(ch)
+	}
+
+	m.mu.Lock()
+	depths := make(map[string]int)
+	for sub := range m.queues {
+		depths[sub.name] += sub.queueDepth()
+	}
+	m.mu.Unlock()
+	for name, depth := range depths {
+		ch <- prometheus.MustNewConstMetric(m.queueDepth, prometheus.GaugeValue, float64(depth), name)
+	}
+}
+
+// The recording methods below are no-ops on a nil *Metrics, so clients without WithMetrics pay nothing.
+
+func (m *Metrics) publishAttempt(topic, eventType string, err error) {
+	if m != nil {
+		m.publishAttempts.WithLabelValues(topic, eventType, outcome(err)).Inc()
+	}
+}
+
+func (m *Metrics) publishFailed(topic, eventType string) {
+	if m != nil {
+		m.publishFailures.WithLabelValues(topic, eventType).Inc()
+	}
+}
+
+func (m *Metrics) handled(topic, eventType, result string, duration time.Duration) {
+	if m != nil {
+		m.handlerDuration.WithLabelValues(topic, eventType, result).Observe(duration.Seconds())
+	}
+}
+
+func (m *Metrics) acked(topic, subscriptionName string) {
+	if m != nil {
+		m.acks.WithLabelValues(topic, subscriptionName).Inc()
+	}
+}
+
+func (m *Metrics) nacked(topic, subscriptionName string) {
+	if m != nil {
+		m.nacks.WithLabelValues(topic, subscriptionName).Inc()
+	}
+}
+
+func (m *Metrics) deadLettered(topic, reason string, err error) {
+	if m != nil {
+		m.dlqSends.WithLabelValues(topic, reason, outcome(err)).Inc()
+	}
+}
+
+func (m *Metrics) producerRecreated(topic string) {
+	if m != nil {
+		m.producerRecreations.WithLabelValues(topic).Inc()
+	}
+}
+
+func (m *Metrics) clusterSwitched(serviceURL string) {
+	if m != nil {
+		m.clusterSwitches.WithLabelValues(serviceURL).Inc()
+	}
+}
+
+func (m *Metrics) trackQueue(sub *subscription) {
+	if m != nil {
+		m.mu.Lock()
+		m.queues[sub] = struct{}{}
+		m.mu.Unlock()
+	}
+}
+
+func (m *Metrics) untrackQueue(sub *subscription) {
+	if m != nil {
+		m.mu.Lock()
+		delete(m.queues, sub)
+		m.mu.Unlock()
+	}
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
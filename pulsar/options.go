@@ -0,0 +1,275 @@
+package pulsarClient
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/apache/pulsar-client-go/pulsar/crypto"
+)
+
+const (
+	defaultWorkerCount       = 20
+	defaultMessageBufferSize = 2000
+	defaultMaxDeliveries     = 10
+	defaultDLQSuffix         = ".dead_letter"
+	defaultDedupTTL          = 24 * time.Hour
+)
+
+// ClientOption customises a client created by NewPulsarClient.
+type ClientOption func(*pulsarClient)
+
+// WithMetrics records publishing and consumption in metrics. Register metrics on a Prometheus
+// registry to expose them.
+func WithMetrics(metrics *Metrics) ClientOption {
+	return func(p *pulsarClient) {
+		p.metrics = metrics
+	}
+}
+
+// WithKeyReader enables end-to-end encryption with keyReader, such as a MemoryKeyReader,
+// instead of the keys in the PULSAR.* environment variables. Producers encrypt with
+// encryptionKeys; consumers decrypt with whichever key each message names.
+func WithKeyReader(keyReader crypto.KeyReader, encryptionKeys ...string) ClientOption {
+	return func(p *pulsarClient) {
+		p.keyReader = keyReader
+		p.encKeys = encryptionKeys
+	}
+}
+
+// ConsumerOption customises a subscription created by ListenOnTopics.
+type ConsumerOption func(*consumerConfig)
+
+type consumerConfig struct {
+	subscriptionType    pulsar.SubscriptionType
+	initialPosition     pulsar.SubscriptionInitialPosition
+	consumerName        string
+	autoDiscoveryPeriod time.Duration
+	workerCount         int
+	receiverQueueSize   int
+	dlqEnabled          bool
+	maxDeliveries       uint32
+	dlqSuffix           string
+	nackRedeliveryDelay time.Duration
+	nackBackoffPolicy   pulsar.NackBackoffPolicy
+	ackGrouping         *pulsar.AckGroupingOptions
+	ackTimeout          time.Duration
+	keyOrdered          bool
+	dedupStore          DedupStore
+	dedupTTL            time.Duration
+	retrySchedule       []time.Duration
+
+	maxPendingChunks        int
+	chunkExpiry             time.Duration
+	autoAckIncompleteChunks bool
+
+	rateLimit float64
+	rateBurst int
+}
+
+// newConsumerConfig returns the historical ListenOnTopics behaviour with opts applied on top.
+func newConsumerConfig(opts []ConsumerOption) *consumerConfig {
+	cfg := &consumerConfig{
+		subscriptionType: pulsar.Shared,
+		initialPosition:  pulsar.SubscriptionPositionLatest,
+		workerCount:      defaultWorkerCount,
+		dlqEnabled:       true,
+		maxDeliveries:    defaultMaxDeliveries,
+		dlqSuffix:        defaultDLQSuffix,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.subscriptionType == pulsar.KeyShared {
+		cfg.keyOrdered = true
+	}
+	return cfg
+}
+
+// WithSubscriptionType selects Exclusive, Failover, Shared (default) or KeyShared delivery.
+func WithSubscriptionType(subscriptionType pulsar.SubscriptionType) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		cfg.subscriptionType = subscriptionType
+	}
+}
+
+// WithKeyOrderedDispatch routes messages with the same ordering key (or message key) to the same
+// worker so they are handled strictly in order. It is enabled automatically for KeyShared subscriptions.
+func WithKeyOrderedDispatch() ConsumerOption {
+	return func(cfg *consumerConfig) {
+		cfg.keyOrdered = true
+	}
+}
+
+// WithInitialPosition sets where a new subscription starts reading: latest (default) or earliest.
+func WithInitialPosition(position pulsar.SubscriptionInitialPosition) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		cfg.initialPosition = position
+	}
+}
+
+// WithConsumerName overrides the random "<APP.SERVICE.NAME>-consumer-NN" name.
+func WithConsumerName(name string) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		cfg.consumerName = name
+	}
+}
+
+// WithAutoDiscoveryPeriod sets how often ListenOnPattern looks for new topics matching its pattern.
+func WithAutoDiscoveryPeriod(period time.Duration) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		cfg.autoDiscoveryPeriod = period
+	}
+}
+
+// WithWorkerCount sets how many goroutines call the handler concurrently. Use 1 for ordered streams.
+func WithWorkerCount(workers int) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		if workers > 0 {
+			cfg.workerCount = workers
+		}
+	}
+}
+
+// WithReceiverQueueSize sets the consumer's receiver queue and the worker channel buffer to size.
+func WithReceiverQueueSize(size int) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		if size > 0 {
+			cfg.receiverQueueSize = size
+		}
+	}
+}
+
+// WithDLQPolicy dead-letters messages to "<topic><suffix>" after maxDeliveries attempts.
+func WithDLQPolicy(maxDeliveries uint32, suffix string) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		cfg.dlqEnabled = true
+		if maxDeliveries > 0 {
+			cfg.maxDeliveries = maxDeliveries
+		}
+		if suffix != "" {
+			cfg.dlqSuffix = suffix
+		}
+	}
+}
+
+// WithoutDLQ disables dead-lettering: failed messages are redelivered indefinitely and
+// unparseable ones are acked and dropped.
+func WithoutDLQ() ConsumerOption {
+	return func(cfg *consumerConfig) {
+		cfg.dlqEnabled = false
+	}
+}
+
+// WithNackRedeliveryDelay sets the fixed delay before a nacked message is redelivered.
+func WithNackRedeliveryDelay(delay time.Duration) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		cfg.nackRedeliveryDelay = delay
+	}
+}
+
+// WithNackBackoffPolicy computes the nack redelivery delay from the redelivery count instead of
+// using a fixed delay.
+func WithNackBackoffPolicy(policy pulsar.NackBackoffPolicy) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		cfg.nackBackoffPolicy = policy
+	}
+}
+
+// WithAckGrouping batches acknowledgements, sending them once maxSize acks are pending or maxTime
+// has passed.
+func WithAckGrouping(maxSize uint32, maxTime time.Duration) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		cfg.ackGrouping = &pulsar.AckGroupingOptions{
+			MaxSize: maxSize,
+			MaxTime: maxTime,
+		}
+	}
+}
+
+// WithAckTimeout redelivers a message that is neither acked nor nacked within timeout of a worker
+// taking it, e.g. because its handler hangs or the subscription stays paused. The Go client has no
+// ack timeout of its own, so the subscription nacks such a message itself; the handler holding it
+// keeps running.
+func WithAckTimeout(timeout time.Duration) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		cfg.ackTimeout = timeout
+	}
+}
+
+// dlqTopic returns the dead-letter topic for topic, or "" when dead-lettering is disabled.
+func (cfg *consumerConfig) dlqTopic(topic string) string {
+	if !cfg.dlqEnabled {
+		return ""
+	}
+	return topic + cfg.dlqSuffix
+}
+
+// messageBufferSize is the capacity of the channel between the consumer and its workers.
+func (cfg *consumerConfig) messageBufferSize() int {
+	if cfg.receiverQueueSize > 0 {
+		return cfg.receiverQueueSize
+	}
+	return defaultMessageBufferSize
+}
+
+// resolveConsumerName returns the configured name or a random one derived from APP.SERVICE.NAME.
+func (cfg *consumerConfig) resolveConsumerName() (string, error) {
+	if cfg.consumerName != "" {
+		return cfg.consumerName, nil
+	}
+	serviceName := os.Getenv("APP.SERVICE.NAME")
+	if serviceName == "" {
+		return "", fmt.Errorf("APP.SERVICE.NAME environment variable not set")
+	}
+	return fmt.Sprintf("%s-consumer-%02d", serviceName, rand.Intn(100)), nil
+}
+
+// PublishOption customises the message sent by PublishEvent.
+type PublishOption func(*pulsar.ProducerMessage)
+
+// newProducerMessage builds the message for an encoded event with opts applied.
+func newProducerMessage(payload []byte, opts []PublishOption) *pulsar.ProducerMessage {
+	message := &pulsar.ProducerMessage{
+		Payload: payload,
+	}
+	for _, opt := range opts {
+		opt(message)
+	}
+	return message
+}
+
+// WithKey sets the message key, used for topic compaction, partition routing and Key_Shared delivery.
+func WithKey(key string) PublishOption {
+	return func(message *pulsar.ProducerMessage) {
+		message.Key = key
+	}
+}
+
+// WithOrderingKey sets a key that overrides the message key for Key_Shared ordering only.
+func WithOrderingKey(key string) PublishOption {
+	return func(message *pulsar.ProducerMessage) {
+		message.OrderingKey = key
+	}
+}
+
+// WithEventTime sets the application-defined time at which the event happened.
+func WithEventTime(eventTime time.Time) PublishOption {
+	return func(message *pulsar.ProducerMessage) {
+		message.EventTime = eventTime
+	}
+}
+
+// WithProperties adds custom properties to the message. Later options overwrite earlier keys.
+func WithProperties(properties map[string]string) PublishOption {
+	return func(message *pulsar.ProducerMessage) {
+		if message.Properties == nil {
+			message.Properties = make(map[string]string, len(properties))
+		}
+		for k, v := range properties {
+			message.Properties[k] = v
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package pulsarClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// OutboxRecord is an event waiting in the outbox. Payload holds the fully encoded flow-system
+// event, so the event ID and timestamp are fixed when the record is appended. The remaining fields
+// keep what the PublishOptions set on the message.
+type OutboxRecord struct {
+	ID          uint64            `json:"id"`
+	Topic       string            `json:"topic"`
+	EventType   string            `json:"event_type"`
+	Key         string            `json:"key,omitempty"`
+	OrderingKey string            `json:"ordering_key,omitempty"`
+	EventTime   time.Time         `json:"event_time,omitzero"`
+	DeliverAt   time.Time         `json:"deliver_at,omitzero"`
+	Properties  map[string]string `json:"properties,omitempty"`
+	Payload     []byte            `json:"payload"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// OutboxStore is the durable journal behind an Outbox. Implementations backed by the service's own
+// database can append in the same transaction as the business write, which makes the outbox
+// fully transactional.
+type OutboxStore interface {
+	// Append durably stores record, assigns its ID and returns it.
+	Append(ctx context.Context, record OutboxRecord) (uint64, error)
+	// Pending returns up to limit undelivered records in append order.
+	Pending(ctx context.Context, limit int) ([]OutboxRecord, error)
+	// MarkDelivered removes records from the pending set.
+	MarkDelivered(ctx context.Context, ids ...uint64) error
+	// PendingCount returns the number of undelivered records.
+	PendingCount(ctx context.Context) (int, error)
+	Close() error
+}
+
+// OutboxOptions tunes the relay of an Outbox. Zero values fall back to the defaults.
+type OutboxOptions struct {
+	// BatchSize is the number of pending records loaded per relay pass. Default 100.
+	BatchSize int
+	// PollInterval is how often the relay checks the store when idle. Default 1s.
+	PollInterval time.Duration
+	// MinBackoff and MaxBackoff bound the exponential delay after a failed publish. Default 1s and 1m.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// OutboxStats describes the relay's progress. Lag is the age of the oldest undelivered record.
+type OutboxStats struct {
+	Pending     int
+	Lag         time.Duration
+	Delivered   uint64
+	Failures    uint64
+	LastError   error
+	LastRelayed time.Time
+}
+
+// Outbox stores events locally first and relays them to Pulsar in order, so an event is never
+// lost if the process dies between a database write and the publish. Delivery is at-least-once:
+// a crash after a publish but before MarkDelivered republishes that record.
+type Outbox struct {
+	client  PulsarClient
+	store   OutboxStore
+	options OutboxOptions
+	notify  chan struct{}
+
+	mu    sync.Mutex
+	stats OutboxStats
+}
+
+// NewOutbox creates an Outbox that relays from store through client. Call Start or Run to relay.
+func NewOutbox(client PulsarClient, store OutboxStore, options OutboxOptions) *Outbox {
+	if options.BatchSize <= 0 {
+		options.BatchSize = 100
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = time.Second
+	}
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = time.Second
+	}
+	if options.MaxBackoff < options.MinBackoff {
+		options.MaxBackoff = time.Minute
+	}
+	return &Outbox{
+		client:  client,
+		store:   store,
+		options: options,
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// Add appends an event to the outbox. It returns once the record is durable; publishing happens
+// later on the relay.
+func (o *Outbox) Add(ctx context.Context, topic, eventType string, payload any, opts ...PublishOption) error {
+	encode := encodeEvent
+	var upcasters *Upcasters
+	if client, ok := o.client.(*pulsarClient); ok {
+		encode = client.encodeWithSchema
+		upcasters = client.upcasters
+	}
+	payloadBytes, err := encode(topic, eventType, payload)
+	if err != nil {
+		return err
+	}
+
+	// Apply the options to a scratch message so everything they set can be stored with the record.
+	message := newProducerMessage(payloadBytes, opts)
+	stampEventVersion(upcasters, eventType, message)
+	// The trace context is stored with the record so the relayed message continues the caller's trace.
+	injectTraceContext(ctx, message)
+	if _, err := o.store.Append(ctx, OutboxRecord{
+		Topic:       topic,
+		EventType:   eventType,
+		Key:         message.Key,
+		OrderingKey: message.OrderingKey,
+		EventTime:   message.EventTime,
+		DeliverAt:   message.DeliverAt,
+		Properties:  message.Properties,
+		Payload:     payloadBytes,
+		CreatedAt:   time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to append event '%s' to outbox: %w", eventType, err)
+	}
+
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start runs the relay in a goroutine until ctx is cancelled.
+func (o *Outbox) Start(ctx context.Context) {
+	go func() {
+		if err := o.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			PulsarLogError("Outbox relay stopped: %v", err)
+		}
+	}()
+}
+
+// Run relays pending records until ctx is cancelled. A record is only attempted after every
+// record before it has been delivered, so per-outbox order is preserved.
+func (o *Outbox) Run(ctx context.Context) error {
+	PulsarLogInfo("Outbox relay started")
+	backoff := o.options.MinBackoff
+	for {
+		delivered, err := o.relayBatch(ctx)
+		o.refreshStats(ctx)
+		switch {
+		case err != nil:
+			o.recordFailure(err)
+			PulsarLogError("Outbox relay failed, retrying in %s: %v", backoff, err)
+			if err := sleepContext(ctx, backoff); err != nil {
+				return err
+			}
+			backoff = min(backoff*2, o.options.MaxBackoff)
+		case delivered == 0:
+			backoff = o.options.MinBackoff
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-o.notify:
+			case <-time.After(o.options.PollInterval):
+			}
+		default:
+			backoff = o.options.MinBackoff
+		}
+	}
+}
+
+// relayBatch publishes the next batch of pending records and returns how many were delivered.
+func (o *Outbox) relayBatch(ctx context.Context) (int, error) {
+	records, err := o.store.Pending(ctx, o.options.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load pending outbox records: %w", err)
+	}
+
+	for i, record := range records {
+		producer, err := o.client.GetOrCreateProducer(record.Topic)
+		if err != nil {
+			return i, fmt.Errorf("failed to get producer for topic %s: %w", record.Topic, err)
+		}
+		// A scheduled record relayed after its delivery time is delivered straight away.
+		if _, err := producer.Send(ctx, &pulsar.ProducerMessage{
+			Payload:     record.Payload,
+			Key:         record.Key,
+			OrderingKey: record.OrderingKey,
+			EventTime:   record.EventTime,
+			DeliverAt:   record.DeliverAt,
+			Properties:  record.Properties,
+		}); err != nil {
+			// Drop the producer as PublishEvent does, or the next relay would get the same broken
+			// one back from the cache.
+			if client, ok := o.client.(*pulsarClient); ok {
+				client.evictProducer(record.Topic, producer)
+				producer.Close()
+			}
+			return i, fmt.Errorf("failed to relay outbox record %d to topic %s: %w", record.ID, record.Topic, err)
+		}
+		if err := o.store.MarkDelivered(ctx, record.ID); err != nil {
+			return i, fmt.Errorf("failed to mark outbox record %d delivered: %w", record.ID, err)
+		}
+
+		o.mu.Lock()
+		o.stats.Delivered++
+		o.stats.LastRelayed = time.Now()
+		o.mu.Unlock()
+		PulsarLogInfo("Relayed outbox event '%s' to topic '%s'", record.EventType, record.Topic)
+	}
+	return len(records), nil
+}
+
+// Stats returns a snapshot of the relay's lag and counters.
+func (o *Outbox) Stats() OutboxStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.stats
+}
+
+func (o *Outbox) refreshStats(ctx context.Context) {
+	oldest, err := o.store.Pending(ctx, 1)
+	if err != nil {
+		return
+	}
+	count, err := o.store.PendingCount(ctx)
+	if err != nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stats.Pending = count
+	o.stats.Lag = 0
+	if len(oldest) > 0 {
+		o.stats.Lag = time.Since(oldest[0].CreatedAt)
+	}
+}
+
+func (o *Outbox) recordFailure(err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stats.Failures++
+	o.stats.LastError = err
+}
+
+// sleepContext waits for d or until ctx ends, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
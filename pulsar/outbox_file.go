@@ -0,0 +1,232 @@
+package pulsarClient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// compactThreshold is the number of delivered records after which the journal is rewritten.
+const compactThreshold = 1000
+
+// journalEntry is one line of the outbox journal file.
+type journalEntry struct {
+	Op     string        `json:"op"`
+	Record *OutboxRecord `json:"record,omitempty"`
+	IDs    []uint64      `json:"ids,omitempty"`
+}
+
+const (
+	journalOpAppend    = "append"
+	journalOpDelivered = "delivered"
+)
+
+// FileOutboxStore is an OutboxStore backed by an append-only JSON-lines journal on local disk.
+// Every write is fsynced before it returns. The journal is compacted once enough records have
+// been delivered.
+type FileOutboxStore struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	nextID    uint64
+	pending   []OutboxRecord
+	delivered int
+}
+
+// NewFileOutboxStore opens or creates the journal at path and restores the undelivered records.
+func NewFileOutboxStore(path string) (*FileOutboxStore, error) {
+	store := &FileOutboxStore{path: path, nextID: 1}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	if err := store.compact(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// load replays the journal. A truncated final line, left by a crash mid-write, is ignored.
+func (s *FileOutboxStore) load() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open outbox journal %s: %w", s.path, err)
+	}
+	defer file.Close()
+
+	index := make(map[uint64]int)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			PulsarLogError("Skipping corrupt outbox journal entry in %s: %v", s.path, err)
+			continue
+		}
+		switch entry.Op {
+		case journalOpAppend:
+			if entry.Record == nil {
+				continue
+			}
+			index[entry.Record.ID] = len(s.pending)
+			s.pending = append(s.pending, *entry.Record)
+			if entry.Record.ID >= s.nextID {
+				s.nextID = entry.Record.ID + 1
+			}
+		case journalOpDelivered:
+			for _, id := range entry.IDs {
+				if i, found := index[id]; found {
+					s.pending[i].ID = 0
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read outbox journal %s: %w", s.path, err)
+	}
+
+	remaining := s.pending[:0]
+	for _, record := range s.pending {
+		if record.ID != 0 {
+			remaining = append(remaining, record)
+		}
+	}
+	s.pending = remaining
+	return nil
+}
+
+// compact rewrites the journal with only the pending records and reopens it for appending. The
+// new journal is written to a temporary file that is then renamed over the old one; its handle
+// follows the rename, so a failed rename leaves the store appending to the old journal.
+func (s *FileOutboxStore) compact() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create outbox journal %s: %w", tmpPath, err)
+	}
+	discard := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for i := range s.pending {
+		if err := encoder.Encode(journalEntry{Op: journalOpAppend, Record: &s.pending[i]}); err != nil {
+			return discard(fmt.Errorf("failed to write outbox journal %s: %w", tmpPath, err))
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return discard(fmt.Errorf("failed to write outbox journal %s: %w", tmpPath, err))
+	}
+	if err := tmp.Sync(); err != nil {
+		return discard(fmt.Errorf("failed to sync outbox journal %s: %w", tmpPath, err))
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return discard(fmt.Errorf("failed to replace outbox journal %s: %w", s.path, err))
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = tmp
+	s.delivered = 0
+	return nil
+}
+
+// write appends entry to the journal and fsyncs it.
+func (s *FileOutboxStore) write(entry journalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write outbox journal %s: %w", s.path, err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync outbox journal %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *FileOutboxStore) Append(_ context.Context, record OutboxRecord) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return 0, fmt.Errorf("outbox journal %s is closed", s.path)
+	}
+
+	record.ID = s.nextID
+	if err := s.write(journalEntry{Op: journalOpAppend, Record: &record}); err != nil {
+		return 0, err
+	}
+	s.nextID++
+	s.pending = append(s.pending, record)
+	return record.ID, nil
+}
+
+func (s *FileOutboxStore) Pending(_ context.Context, limit int) ([]OutboxRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit <= 0 || limit > len(s.pending) {
+		limit = len(s.pending)
+	}
+	records := make([]OutboxRecord, limit)
+	copy(records, s.pending[:limit])
+	return records, nil
+}
+
+func (s *FileOutboxStore) MarkDelivered(_ context.Context, ids ...uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("outbox journal %s is closed", s.path)
+	}
+
+	if err := s.write(journalEntry{Op: journalOpDelivered, IDs: ids}); err != nil {
+		return err
+	}
+
+	done := make(map[uint64]bool, len(ids))
+	for _, id := range ids {
+		done[id] = true
+	}
+	remaining := s.pending[:0]
+	for _, record := range s.pending {
+		if !done[record.ID] {
+			remaining = append(remaining, record)
+		}
+	}
+	s.delivered += len(s.pending) - len(remaining)
+	s.pending = remaining
+
+	if s.delivered >= compactThreshold && s.delivered > len(s.pending) {
+		return s.compact()
+	}
+	return nil
+}
+
+func (s *FileOutboxStore) PendingCount(_ context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending), nil
+}
+
+func (s *FileOutboxStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,204 @@
+package pulsarClient
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func openOutboxJournal(t *testing.T, path string) *FileOutboxStore {
+	t.Helper()
+	store, err := NewFileOutboxStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func appendRecords(t *testing.T, store *FileOutboxStore, count int) []uint64 {
+	t.Helper()
+	ids := make([]uint64, count)
+	for i := range ids {
+		id, err := store.Append(context.Background(), OutboxRecord{
+			Topic:     "orders",
+			EventType: "order.created",
+			Key:       fmt.Sprintf("order-%d", i),
+			Payload:   []byte(fmt.Sprintf(`{"n":%d}`, i)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+// pendingIDs returns the IDs of the pending records in the order the relay would deliver them.
+func pendingIDs(t *testing.T, store *FileOutboxStore) []uint64 {
+	t.Helper()
+	records, err := store.Pending(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]uint64, len(records))
+	for i, record := range records {
+		ids[i] = record.ID
+	}
+	return ids
+}
+
+func journalLines(t *testing.T, path string) int {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
+
+func TestFileOutboxStoreRestoresPendingRecordsInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.journal")
+	ctx := context.Background()
+	store := openOutboxJournal(t, path)
+
+	eventTime := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	deliverAt := eventTime.Add(time.Hour)
+	id, err := store.Append(ctx, OutboxRecord{
+		Topic:       "payments",
+		EventType:   "payment.completed",
+		Key:         "customer-7",
+		OrderingKey: "payment-9",
+		EventTime:   eventTime,
+		DeliverAt:   deliverAt,
+		Properties:  map[string]string{"tenant": "acme"},
+		Payload:     []byte(`{"amount":10}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := append([]uint64{id}, appendRecords(t, store, 4)...)
+	if err := store.MarkDelivered(ctx, ids[2], ids[4]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first store is never closed, as after a crash.
+	reopened := openOutboxJournal(t, path)
+	if got, want := pendingIDs(t, reopened), []uint64{ids[0], ids[1], ids[3]}; !slices.Equal(got, want) {
+		t.Fatalf("pending after reopen = %v, want %v", got, want)
+	}
+
+	records, _ := reopened.Pending(ctx, 1)
+	record := records[0]
+	if record.Topic != "payments" || record.Key != "customer-7" || record.OrderingKey != "payment-9" ||
+		!record.EventTime.Equal(eventTime) || !record.DeliverAt.Equal(deliverAt) ||
+		record.Properties["tenant"] != "acme" || string(record.Payload) != `{"amount":10}` {
+		t.Fatalf("record restored as %+v", record)
+	}
+
+	next, err := reopened.Append(ctx, OutboxRecord{Topic: "orders", EventType: "order.created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next <= ids[4] {
+		t.Fatalf("ID %d reused after reopen, last ID was %d", next, ids[4])
+	}
+	if count, _ := reopened.PendingCount(ctx); count != 4 {
+		t.Fatalf("pending count = %d, want 4", count)
+	}
+}
+
+func TestFileOutboxStoreIgnoresTruncatedEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.journal")
+	store := openOutboxJournal(t, path)
+	ids := appendRecords(t, store, 3)
+	store.Close()
+
+	// A crash in the middle of a write leaves half a line behind.
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"op":"append","record":{"id":4,"top`)
+	file.Close()
+
+	reopened := openOutboxJournal(t, path)
+	if got := pendingIDs(t, reopened); !slices.Equal(got, ids) {
+		t.Fatalf("pending after truncated write = %v, want %v", got, ids)
+	}
+	more := appendRecords(t, reopened, 1)
+
+	// Opening compacted the half line away, so the record appended after it survives as well.
+	again := openOutboxJournal(t, path)
+	if got, want := pendingIDs(t, again), append(ids, more...); !slices.Equal(got, want) {
+		t.Fatalf("pending after second reopen = %v, want %v", got, want)
+	}
+}
+
+func TestFileOutboxStoreCompactsDeliveredRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.journal")
+	ctx := context.Background()
+	store := openOutboxJournal(t, path)
+
+	ids := appendRecords(t, store, compactThreshold+10)
+	if err := store.MarkDelivered(ctx, ids[:compactThreshold]...); err != nil {
+		t.Fatal(err)
+	}
+	if lines := journalLines(t, path); lines != 10 {
+		t.Fatalf("journal has %d lines after compaction, want 10", lines)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary journal left behind: %v", err)
+	}
+
+	// The compacted journal keeps taking appends and delivery marks.
+	more := appendRecords(t, store, 2)
+	if err := store.MarkDelivered(ctx, ids[compactThreshold]); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openOutboxJournal(t, path)
+	want := append(slices.Clone(ids[compactThreshold+1:]), more...)
+	if got := pendingIDs(t, reopened); !slices.Equal(got, want) {
+		t.Fatalf("pending after compaction and reopen = %v, want %v", got, want)
+	}
+}
+
+func TestFileOutboxStoreSurvivesFailedCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.journal")
+	store := openOutboxJournal(t, path)
+	appendRecords(t, store, 1)
+
+	// A non-empty directory at the journal path makes the rename fail.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "blocker"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	store.mu.Lock()
+	err := store.compact()
+	store.mu.Unlock()
+	if err == nil {
+		t.Fatal("compaction over a directory succeeded")
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary journal left behind: %v", err)
+	}
+
+	ids := appendRecords(t, store, 1)
+	if err := store.MarkDelivered(context.Background(), ids...); err != nil {
+		t.Fatalf("store unusable after failed compaction: %v", err)
+	}
+}
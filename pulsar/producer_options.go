@@ -0,0 +1,75 @@
+package pulsarClient
+
+import (
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// ProducerOptions tunes the producer of a topic. The zero value keeps the Pulsar defaults:
+// no compression, batching on, no chunking.
+type ProducerOptions struct {
+	// Compression is pulsar.LZ4, pulsar.ZLib or pulsar.ZSTD; CompressionLevel trades speed for size.
+	Compression      pulsar.CompressionType
+	CompressionLevel pulsar.CompressionLevel
+
+	// EnableChunking splits payloads larger than the broker's maximum message size (5MB by default)
+	// into chunks that consumers reassemble before the event is parsed. Batching is disabled, as
+	// Pulsar does not support both at once. ChunkMaxMessageSize caps the size of each chunk.
+	EnableChunking      bool
+	ChunkMaxMessageSize uint
+
+	// DisableBatching sends every message on its own.
+	DisableBatching bool
+	// BatchingMaxMessages, BatchingMaxSize (bytes) and BatchingMaxPublishDelay bound a batch. A
+	// batch is sent as soon as any of them is reached.
+	BatchingMaxMessages     uint
+	BatchingMaxSize         uint
+	BatchingMaxPublishDelay time.Duration
+}
+
+// WithProducerOptions applies options to the producer of topic, and to the retry and DLQ topics
+// derived from it. Use an empty topic to set the options of every topic that has none of its own.
+func WithProducerOptions(topic string, options ProducerOptions) ClientOption {
+	return func(p *pulsarClient) {
+		if p.producerOptions == nil {
+			p.producerOptions = make(map[string]ProducerOptions)
+		}
+		if topic != "" {
+			topic = qualifiedTopic(topic)
+		}
+		p.producerOptions[topic] = options
+	}
+}
+
+// producerOptionsFor returns the options configured for topic, falling back to the default ones.
+func (p *pulsarClient) producerOptionsFor(topic string) ProducerOptions {
+	if options, found := p.producerOptions[qualifiedTopic(topic)]; found {
+		return options
+	}
+	return p.producerOptions[""]
+}
+
+// apply copies o onto the options of a producer being created.
+func (o ProducerOptions) apply(options *pulsar.ProducerOptions) {
+	options.CompressionType = o.Compression
+	options.CompressionLevel = o.CompressionLevel
+	options.DisableBatching = o.DisableBatching || o.EnableChunking
+	options.EnableChunking = o.EnableChunking
+	options.ChunkMaxMessageSize = o.ChunkMaxMessageSize
+	options.BatchingMaxMessages = o.BatchingMaxMessages
+	options.BatchingMaxSize = o.BatchingMaxSize
+	options.BatchingMaxPublishDelay = o.BatchingMaxPublishDelay
+}
+
+// WithChunkReassembly tunes how the consumer reassembles chunked messages. At most maxPending
+// partially received messages are buffered (default 100); beyond that the oldest is dropped, and
+// acked if autoAck is set. Chunks still incomplete after expireAfter (default one minute) are
+// discarded.
+func WithChunkReassembly(maxPending int, expireAfter time.Duration, autoAck bool) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		cfg.maxPendingChunks = maxPending
+		cfg.chunkExpiry = expireAfter
+		cfg.autoAckIncompleteChunks = autoAck
+	}
+}
@@ -0,0 +1,211 @@
+package pulsarClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// Event is one entry of a PublishEvents batch.
+type Event struct {
+	EventType string
+	Payload   any
+	Options   []PublishOption
+}
+
+// PublishResult is the outcome of publishing one event: the broker-assigned message ID, or an error.
+type PublishResult struct {
+	MessageID pulsar.MessageID
+	Err       error
+}
+
+// PublishCallback receives the outcome of PublishEventAsync. It runs on the producer's event loop
+// and must not block.
+type PublishCallback func(pulsar.MessageID, error)
+
+// PublishEvents sends all events to topic through the producer's SendAsync and batching, then waits
+// until each one is acknowledged. Results are returned in the order of events. If ctx ends first,
+// events still in flight are reported with ctx.Err(), although the broker may yet accept them.
+func (p *pulsarClient) PublishEvents(ctx context.Context, topic string, events []Event) []PublishResult {
+	results := make([]PublishResult, len(events))
+	if len(events) == 0 {
+		return results
+	}
+
+	var (
+		mu        sync.Mutex
+		remaining = len(events)
+		done      = make(chan struct{})
+		finished  bool
+	)
+	complete := func(i int, id pulsar.MessageID, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if finished {
+			return
+		}
+		results[i] = PublishResult{MessageID: id, Err: err}
+		remaining--
+		if remaining == 0 {
+			close(done)
+		}
+	}
+
+	for i, event := range events {
+		p.PublishEventAsync(ctx, topic, event.EventType, event.Payload, func(id pulsar.MessageID, err error) {
+			complete(i, id, err)
+		}, event.Options...)
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		mu.Lock()
+		finished = true
+		for i := range results {
+			if results[i].MessageID == nil && results[i].Err == nil {
+				results[i].Err = ctx.Err()
+			}
+		}
+		mu.Unlock()
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		PulsarLogError("Published %d/%d events to topic '%s' (%d failed)", len(events)-failed, len(events), topic, failed)
+	} else {
+		PulsarLogInfo("Published %d events to topic '%s'", len(events), topic)
+	}
+	return results
+}
+
+// PublishEventAsync queues an event on the topic's producer and returns immediately. callback, if
+// not nil, is called exactly once with the message ID or the error. Use Flush to wait for pending sends.
+func (p *pulsarClient) PublishEventAsync(ctx context.Context, topic, eventType string, payload any, callback PublishCallback, opts ...PublishOption) {
+	if callback == nil {
+		callback = func(pulsar.MessageID, error) {}
+	}
+	ctx, span := p.startPublishSpan(ctx, topic, eventType)
+	done := callback
+	callback = func(id pulsar.MessageID, err error) {
+		endSpan(span, err)
+		done(id, err)
+	}
+
+	payloadBytes, err := p.encodeWithSchema(topic, eventType, payload)
+	if err != nil {
+		p.metrics.publishFailed(topic, eventType)
+		callback(nil, err)
+		return
+	}
+
+	producer, err := p.GetOrCreateProducer(topic)
+	if err != nil {
+		PulsarLogError("failed to get producer for topic %s: %v", topic, err)
+		p.metrics.publishFailed(topic, eventType)
+		callback(nil, fmt.Errorf("failed to get producer for topic %s: %w", topic, err))
+		return
+	}
+
+	message := newProducerMessage(payloadBytes, opts)
+	stampEventVersion(p.upcasters, eventType, message)
+	injectTraceContext(ctx, message)
+
+	p.pending.add()
+	producer.SendAsync(ctx, message, func(id pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+		defer p.pending.done()
+		p.metrics.publishAttempt(topic, eventType, err)
+		if err != nil {
+			PulsarLogError("Failed to publish event '%s' to topic %s: %v", eventType, topic, err)
+			p.metrics.publishFailed(topic, eventType)
+			if errors.Is(err, pulsar.ErrProducerClosed) {
+				p.evictProducer(topic, producer)
+			}
+		}
+		callback(id, err)
+	})
+}
+
+// Flush flushes every cached producer and waits until all asynchronous sends have completed.
+func (p *pulsarClient) Flush(ctx context.Context) error {
+	p.mu.RLock()
+	producers := make(map[string]pulsar.Producer, len(p.producers))
+	for topic, producer := range p.producers {
+		producers[topic] = producer
+	}
+	p.mu.RUnlock()
+
+	var errs []error
+	for topic, producer := range producers {
+		if err := producer.FlushWithCtx(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to flush producer for topic %s: %w", topic, err))
+		}
+	}
+	if err := p.pending.wait(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("timed out waiting for pending sends: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// evictProducer removes producer from the cache if it is still the cached producer for topic, so
+// the next publish creates a fresh one.
+func (p *pulsarClient) evictProducer(topic string, producer pulsar.Producer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cached, found := p.producers[topic]; found && cached == producer {
+		delete(p.producers, topic)
+		p.metrics.producerRecreated(topic)
+	}
+}
+
+// pendingSends counts asynchronous sends whose callback has not fired yet.
+type pendingSends struct {
+	mu    sync.Mutex
+	count int
+	idle  chan struct{} // closed whenever count is zero
+}
+
+func newPendingSends() *pendingSends {
+	idle := make(chan struct{})
+	close(idle)
+	return &pendingSends{idle: idle}
+}
+
+func (s *pendingSends) add() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count == 0 {
+		s.idle = make(chan struct{})
+	}
+	s.count++
+}
+
+func (s *pendingSends) done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count--
+	if s.count == 0 {
+		close(s.idle)
+	}
+}
+
+// wait blocks until no sends are pending or ctx ends.
+func (s *pendingSends) wait(ctx context.Context) error {
+	s.mu.Lock()
+	idle := s.idle
+	s.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
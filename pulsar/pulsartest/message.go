@@ -0,0 +1,76 @@
+package pulsartest
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// message is the in-memory pulsar.Message handed to handlers.
+type message struct {
+	topic           string
+	producerName    string
+	properties      map[string]string
+	payload         []byte
+	id              pulsar.MessageID
+	publishTime     time.Time
+	eventTime       time.Time
+	key             string
+	orderingKey     string
+	redeliveryCount uint32
+}
+
+func (m *message) Topic() string                                   { return m.topic }
+func (m *message) ProducerName() string                            { return m.producerName }
+func (m *message) Properties() map[string]string                   { return m.properties }
+func (m *message) Payload() []byte                                 { return m.payload }
+func (m *message) ID() pulsar.MessageID                            { return m.id }
+func (m *message) PublishTime() time.Time                          { return m.publishTime }
+func (m *message) EventTime() time.Time                            { return m.eventTime }
+func (m *message) Key() string                                     { return m.key }
+func (m *message) OrderingKey() string                             { return m.orderingKey }
+func (m *message) RedeliveryCount() uint32                         { return m.redeliveryCount }
+func (m *message) IsReplicated() bool                              { return false }
+func (m *message) GetReplicatedFrom() string                       { return "" }
+func (m *message) GetSchemaValue(interface{}) error                { return nil }
+func (m *message) SchemaVersion() []byte                           { return nil }
+func (m *message) GetEncryptionContext() *pulsar.EncryptionContext { return nil }
+func (m *message) Index() *uint64                                  { return nil }
+func (m *message) BrokerPublishTime() *time.Time                   { return nil }
+
+// redelivered returns a copy of m as the broker would redeliver it after a nack.
+func (m *message) redelivered() *message {
+	next := *m
+	next.redeliveryCount++
+	return &next
+}
+
+// producer is the in-memory pulsar.Producer returned by GetOrCreateProducer. Sent messages are
+// recorded and delivered like published events.
+type producer struct {
+	client *Client
+	topic  string
+	seq    atomic.Int64
+}
+
+func (p *producer) Topic() string { return p.topic }
+func (p *producer) Name() string  { return "pulsartest-producer" }
+
+func (p *producer) Send(ctx context.Context, msg *pulsar.ProducerMessage) (pulsar.MessageID, error) {
+	p.seq.Add(1)
+	return p.client.send(ctx, p.topic, "", nil, msg)
+}
+
+func (p *producer) SendAsync(ctx context.Context, msg *pulsar.ProducerMessage, callback func(pulsar.MessageID, *pulsar.ProducerMessage, error)) {
+	id, err := p.Send(ctx, msg)
+	if callback != nil {
+		callback(id, msg, err)
+	}
+}
+
+func (p *producer) LastSequenceID() int64                  { return p.seq.Load() }
+func (p *producer) Flush() error                           { return nil }
+func (p *producer) FlushWithCtx(ctx context.Context) error { return p.client.Flush(ctx) }
+func (p *producer) Close()                                 {}
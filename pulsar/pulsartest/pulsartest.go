@@ -0,0 +1,791 @@
+// Package pulsartest provides an in-memory implementation of pulsarClient.PulsarClient for unit
+// testing services without a broker. Published events are recorded for assertions and delivered
+// to handlers registered with ListenOnTopics or ListenOnPattern, including nack redelivery and
+// DLQ routing.
+package pulsartest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	sysResponse "github.com/factory24/flow-system/pkg/response"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+
+	pulsarClient "github.com/factory24/athari-thirdparty/pulsar"
+	"github.com/factory24/athari-thirdparty/pulsar/internal/dispatch"
+)
+
+const (
+	defaultMaxDeliveries  = 10
+	defaultRequestTimeout = 5 * time.Second
+	dlqSuffix             = ".dead_letter"
+
+	// ReplyTopic is the topic the fake client receives replies to Request on.
+	ReplyTopic = "persistent://public/default/pulsartest-replies"
+	// ServiceURL is the service URL the fake client reports from ActiveURL.
+	ServiceURL = "pulsartest://local"
+)
+
+var partitionSuffix = regexp.MustCompile(`-partition-\d+$`)
+
+// PublishedEvent is a message recorded by the fake client.
+type PublishedEvent struct {
+	// Topic is the fully qualified topic, e.g. persistent://public/default/orders for "orders".
+	Topic string
+	// EventType is parsed from the flow-system envelope, or "" for payloads that are not events.
+	EventType string
+	// Payload is the value passed to PublishEvent, or nil for messages sent through a producer.
+	Payload     any
+	Message     *pulsar.ProducerMessage
+	MessageID   pulsar.MessageID
+	PublishTime time.Time
+
+	// delivered is the message handed to listeners, kept for ReplayTopic.
+	delivered *message
+}
+
+// Decode decodes the event payload carried by the message into target.
+func (e PublishedEvent) Decode(target any) error {
+	header, err := sysResponse.ParseEventHeader(e.Message.Payload)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(header.Payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, target)
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithAsyncDelivery delivers each published event on its own goroutine. Use Wait to block until
+// every delivery, including redeliveries, has finished. By default delivery is synchronous and
+// PublishEvent returns only after all handlers have run. Only asynchronous delivery waits for the
+// delay of a NackAfter outcome; synchronous delivery redelivers at once.
+func WithAsyncDelivery() Option {
+	return func(c *Client) {
+		c.async = true
+	}
+}
+
+// WithMaxDeliveries sets how many times a failing event is delivered before it is dead-lettered.
+func WithMaxDeliveries(maxDeliveries int) Option {
+	return func(c *Client) {
+		if maxDeliveries > 0 {
+			c.maxDeliveries = maxDeliveries
+		}
+	}
+}
+
+// WithRequestTimeout sets how long Request waits for a reply with asynchronous delivery. With
+// synchronous delivery a request that has not been answered once it is published fails at once.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		if timeout > 0 {
+			c.requestTimeout = timeout
+		}
+	}
+}
+
+// WithUpcasters stamps published events with their latest version and upcasts older events
+// before they reach handlers, like pulsarClient.WithUpcasters.
+func WithUpcasters(upcasters *pulsarClient.Upcasters) Option {
+	return func(c *Client) {
+		c.upcasters = upcasters
+	}
+}
+
+// WithTopics sets the topics returned by GetTopics.
+func WithTopics(topics ...string) Option {
+	return func(c *Client) {
+		c.topics = topics
+	}
+}
+
+// Client is an in-memory PulsarClient. Consumer options passed to ListenOnTopics are accepted but
+// ignored: every subscription behaves as a Shared subscription with a "<topic>.dead_letter" DLQ.
+// Like the real client, it expands short topic names such as "orders" to
+// persistent://public/default/orders, so either form can be used anywhere a topic is taken.
+type Client struct {
+	mu             sync.Mutex
+	async          bool
+	maxDeliveries  int
+	requestTimeout time.Duration
+	topics         []string
+	published      []PublishedEvent
+	listeners      []*listener
+	deadLetters    map[string][]pulsarClient.DLQMessage
+	schemas        map[string]*pulsarClient.Schema
+	upcasters      *pulsarClient.Upcasters
+	requests       map[string]chan *pulsarClient.EventHeader
+	acked          int
+	nacked         int
+	nextEntry      int64
+	inflight       sync.WaitGroup
+	closed         bool
+}
+
+var _ pulsarClient.PulsarClient = (*Client)(nil)
+
+type listener struct {
+	ctx          context.Context
+	subscription string
+	topics       []string
+	pattern      *regexp.Regexp
+	handler      pulsarClient.EventHandler
+
+	// Flow control state, guarded by Client.mu.
+	paused    bool
+	held      []*message
+	rateLimit float64
+	rateBurst int
+	workers   int
+}
+
+func (l *listener) matches(topic string) bool {
+	if l.ctx.Err() != nil {
+		return false
+	}
+	if l.pattern != nil {
+		return l.pattern.MatchString(topic)
+	}
+	return slices.Contains(l.topics, topic)
+}
+
+// NewClient creates an empty in-memory client.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		maxDeliveries:  defaultMaxDeliveries,
+		requestTimeout: defaultRequestTimeout,
+		deadLetters:    make(map[string][]pulsarClient.DLQMessage),
+		schemas:        make(map[string]*pulsarClient.Schema),
+		requests:       make(map[string]chan *pulsarClient.EventHeader),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Client) Connect() {}
+
+func (c *Client) GetTopics() []string {
+	return c.topics
+}
+
+func (c *Client) PublishEvent(ctx context.Context, topic, eventType string, payload any, opts ...pulsarClient.PublishOption) error {
+	_, err := c.publish(ctx, topic, eventType, payload, opts)
+	return err
+}
+
+func (c *Client) PublishEventAfter(ctx context.Context, topic, eventType string, payload any, delay time.Duration, opts ...pulsarClient.PublishOption) error {
+	return c.PublishEventAt(ctx, topic, eventType, payload, time.Now().Add(delay), opts...)
+}
+
+// PublishEventAt records the scheduled time but delivers the event immediately.
+func (c *Client) PublishEventAt(ctx context.Context, topic, eventType string, payload any, deliverAt time.Time, opts ...pulsarClient.PublishOption) error {
+	return c.PublishEvent(ctx, topic, eventType, payload, append(opts, pulsarClient.WithDeliverAt(deliverAt))...)
+}
+
+func (c *Client) PublishEvents(ctx context.Context, topic string, events []pulsarClient.Event) []pulsarClient.PublishResult {
+	results := make([]pulsarClient.PublishResult, len(events))
+	for i, event := range events {
+		results[i].MessageID, results[i].Err = c.publish(ctx, topic, event.EventType, event.Payload, event.Options)
+	}
+	return results
+}
+
+func (c *Client) PublishEventAsync(ctx context.Context, topic, eventType string, payload any, callback pulsarClient.PublishCallback, opts ...pulsarClient.PublishOption) {
+	id, err := c.publish(ctx, topic, eventType, payload, opts)
+	if callback != nil {
+		callback(id, err)
+	}
+}
+
+// Flush waits for asynchronous deliveries, like Wait, until ctx ends.
+func (c *Client) Flush(ctx context.Context) error {
+	return c.waitContext(ctx)
+}
+
+func (c *Client) GetOrCreateProducer(topic string) (pulsar.Producer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, pulsarClient.ErrClientClosed
+	}
+	return &producer{client: c, topic: topic}, nil
+}
+
+func (c *Client) ListenOnTopics(ctx context.Context, topics []string, subscriptionName string, handler pulsarClient.EventHandler, _ ...pulsarClient.ConsumerOption) (pulsarClient.Subscription, error) {
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("no topics given for subscription %s", subscriptionName)
+	}
+	qualified := make([]string, len(topics))
+	for i, topic := range topics {
+		qualified[i] = dispatch.QualifiedTopic(topic)
+	}
+	return c.addListener(&listener{ctx: ctx, subscription: subscriptionName, topics: qualified, handler: handler})
+}
+
+func (c *Client) ListenOnPattern(ctx context.Context, topicsPattern, subscriptionName string, handler pulsarClient.EventHandler, _ ...pulsarClient.ConsumerOption) (pulsarClient.Subscription, error) {
+	pattern, err := regexp.Compile(topicsPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid topics pattern %s: %w", topicsPattern, err)
+	}
+	return c.addListener(&listener{ctx: ctx, subscription: subscriptionName, pattern: pattern, handler: handler})
+}
+
+// Request publishes a request to topic and returns the reply a handler sends with Reply. Replies
+// are recorded under ReplyTopic like any other published event.
+func (c *Client) Request(ctx context.Context, topic, eventType string, payload any, opts ...pulsarClient.PublishOption) (*pulsarClient.EventHeader, error) {
+	correlationID := dispatch.NewCorrelationID()
+	reply := make(chan *pulsarClient.EventHeader, 1)
+	c.mu.Lock()
+	c.requests[correlationID] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.requests, correlationID)
+		c.mu.Unlock()
+	}()
+
+	opts = append(slices.Clip(opts), pulsarClient.WithProperties(dispatch.RequestProperties(ReplyTopic, correlationID)))
+	if _, err := c.publish(ctx, topic, eventType, payload, opts); err != nil {
+		return nil, err
+	}
+	timeout := fmt.Errorf("request '%s' to topic %s (correlation ID: %s): %w", eventType, topic, correlationID, pulsarClient.ErrRequestTimeout)
+	if !c.async {
+		select {
+		case header := <-reply:
+			return header, nil
+		default:
+			return nil, timeout
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+	select {
+	case header := <-reply:
+		return header, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, timeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Reply answers the request being handled with ctx.
+func (c *Client) Reply(ctx context.Context, eventType string, payload any, opts ...pulsarClient.PublishOption) error {
+	replyTo, correlationID, ok := pulsarClient.ReplyAddress(ctx)
+	if !ok {
+		return pulsarClient.ErrNotARequest
+	}
+	opts = append(slices.Clip(opts), pulsarClient.WithProperties(dispatch.ReplyProperties(correlationID)))
+	_, err := c.publish(ctx, replyTo, eventType, payload, opts)
+	return err
+}
+
+// ActiveURL returns ServiceURL; the fake client has a single cluster and never fails over.
+func (c *Client) ActiveURL() string {
+	return ServiceURL
+}
+
+// ReplayTopic feeds the recorded messages of topic to handler, honouring the start, stop and
+// progress settings of options. Dead letters and counters are not affected.
+func (c *Client) ReplayTopic(ctx context.Context, topic string, handler pulsarClient.EventHandler, options pulsarClient.ReplayOptions) (pulsarClient.ReplayProgress, error) {
+	started := time.Now()
+	progress := pulsarClient.ReplayProgress{Topic: topic}
+	stopTime := options.StopTime
+	if stopTime.IsZero() {
+		stopTime = started
+	}
+	progressEvery := options.ProgressEvery
+	if progressEvery <= 0 {
+		progressEvery = 1000
+	}
+	report := func(done bool) {
+		progress.Elapsed = time.Since(started)
+		progress.Done = done
+		if options.Progress != nil {
+			options.Progress(progress)
+		}
+	}
+
+	events := c.PublishedTo(topic)
+	if options.StartMessageID != nil {
+		for i, event := range events {
+			if event.MessageID.String() == options.StartMessageID.String() {
+				events = events[i+1:]
+				break
+			}
+		}
+	}
+	for _, event := range events {
+		if options.StartMessageID == nil && event.PublishTime.Before(options.StartTime) {
+			continue
+		}
+		if event.PublishTime.After(stopTime) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			report(false)
+			return progress, err
+		}
+
+		m := event.delivered
+		dispatchCtx, header, _, err := c.decode(ctx, m)
+		if err == nil {
+			err = dispatch.Handle(dispatchCtx, handler, m, header)
+		}
+		if err != nil {
+			progress.Failed++
+			if !options.SkipFailed {
+				report(false)
+				return progress, fmt.Errorf("replay of topic %s stopped at message %v: %w", topic, m.id, err)
+			}
+		}
+		progress.Processed++
+		progress.LastMessageID = m.id
+		progress.LastPublishTime = m.publishTime
+		if progress.Processed%progressEvery == 0 {
+			report(false)
+		}
+	}
+	report(true)
+	return progress, nil
+}
+
+func (c *Client) addListener(l *listener) (pulsarClient.Subscription, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, pulsarClient.ErrClientClosed
+	}
+	l.workers = 1
+	c.listeners = append(c.listeners, l)
+	return &Subscription{client: c, listener: l}, nil
+}
+
+// Shutdown stops accepting events and waits for asynchronous deliveries until ctx ends.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	return c.waitContext(ctx)
+}
+
+// ProcessDLQMessages moves up to maxMessages dead-lettered messages to targetTopic.
+func (c *Client) ProcessDLQMessages(dlqTopic, targetTopic string, maxMessages int) (int, error) {
+	dlqTopic = dispatch.QualifiedTopic(dlqTopic)
+	c.mu.Lock()
+	messages := c.deadLetters[dlqTopic]
+	if len(messages) > maxMessages {
+		messages = messages[:maxMessages]
+	}
+	messages = slices.Clone(messages)
+	c.mu.Unlock()
+
+	return c.DLQ(dlqTopic, "").Replay(context.Background(), targetTopic, messages...)
+}
+
+func (c *Client) DLQ(dlqTopic, _ string) pulsarClient.DLQBrowser {
+	return &dlqBrowser{client: c, topic: dispatch.QualifiedTopic(dlqTopic)}
+}
+
+// RegisterSchema validates events published to topic and decodes them for handlers, dead-lettering
+// those that do not match with reason "schema_violation".
+func (c *Client) RegisterSchema(topic string, schema *pulsarClient.Schema) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.schemas[dispatch.QualifiedTopic(topic)] = schema
+	return nil
+}
+
+func (c *Client) schemaFor(topic string) *pulsarClient.Schema {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.schemas[dispatch.QualifiedTopic(topic)]
+}
+
+// Published returns every message recorded so far, in publish order.
+func (c *Client) Published() []PublishedEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.published)
+}
+
+// PublishedTo returns the messages recorded for topic.
+func (c *Client) PublishedTo(topic string) []PublishedEvent {
+	topic = dispatch.QualifiedTopic(topic)
+	var events []PublishedEvent
+	for _, event := range c.Published() {
+		if event.Topic == topic {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// PublishedOfType returns the events recorded with eventType on any topic.
+func (c *Client) PublishedOfType(eventType string) []PublishedEvent {
+	var events []PublishedEvent
+	for _, event := range c.Published() {
+		if event.EventType == eventType {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// DeadLettered returns the messages currently in dlqTopic.
+func (c *Client) DeadLettered(dlqTopic string) []pulsarClient.DLQMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.deadLetters[dispatch.QualifiedTopic(dlqTopic)])
+}
+
+// Acked returns how many deliveries the handlers acknowledged.
+func (c *Client) Acked() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.acked
+}
+
+// Nacked returns how many deliveries failed and were redelivered.
+func (c *Client) Nacked() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nacked
+}
+
+// Wait blocks until all asynchronous deliveries have finished.
+func (c *Client) Wait() {
+	c.inflight.Wait()
+}
+
+// Reset forgets recorded messages, dead letters and counters but keeps the listeners.
+func (c *Client) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = nil
+	c.deadLetters = make(map[string][]pulsarClient.DLQMessage)
+	c.acked = 0
+	c.nacked = 0
+}
+
+func (c *Client) waitContext(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// publish wraps payload in a flow-system event, applies opts and sends it.
+func (c *Client) publish(ctx context.Context, topic, eventType string, payload any, opts []pulsarClient.PublishOption) (pulsar.MessageID, error) {
+	encoded := payload
+	if schema := c.schemaFor(topic); schema != nil {
+		var err error
+		if encoded, err = schema.Encode(payload); err != nil {
+			return nil, fmt.Errorf("event '%s' does not match the schema of topic %s: %w", eventType, topic, err)
+		}
+	}
+	data, err := sysResponse.NewEvent(topic, eventType, encoded).Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	msg := &pulsar.ProducerMessage{Payload: data}
+	// As with the real client, only event types with upcasters are published with a version.
+	if latest := c.upcasters.LatestVersion(eventType); latest > 1 {
+		pulsarClient.WithEventVersion(latest)(msg)
+	}
+	for _, opt := range opts {
+		opt(msg)
+	}
+	return c.send(ctx, topic, eventType, payload, msg)
+}
+
+// send records msg and delivers it once to every subscription listening on topic.
+func (c *Client) send(ctx context.Context, topic, eventType string, payload any, msg *pulsar.ProducerMessage) (pulsar.MessageID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	topic = dispatch.QualifiedTopic(topic)
+	if eventType == "" {
+		if header, err := sysResponse.ParseEventHeader(msg.Payload); err == nil {
+			eventType = header.EventType
+		}
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, pulsarClient.ErrClientClosed
+	}
+	c.nextEntry++
+	id := pulsar.NewMessageID(1, c.nextEntry, -1, 0)
+	m := &message{
+		topic:        topic,
+		producerName: "pulsartest-producer",
+		properties:   msg.Properties,
+		payload:      msg.Payload,
+		id:           id,
+		publishTime:  time.Now(),
+		eventTime:    msg.EventTime,
+		key:          msg.Key,
+		orderingKey:  msg.OrderingKey,
+	}
+	if m.properties == nil {
+		m.properties = map[string]string{}
+	}
+	c.published = append(c.published, PublishedEvent{
+		Topic:       topic,
+		EventType:   eventType,
+		Payload:     payload,
+		Message:     msg,
+		MessageID:   id,
+		PublishTime: m.publishTime,
+		delivered:   m,
+	})
+
+	if topic == ReplyTopic {
+		reply, found := c.requests[m.properties[pulsarClient.CorrelationIDProperty]]
+		c.mu.Unlock()
+		if header, err := sysResponse.ParseEventHeader(m.payload); found && err == nil {
+			select {
+			case reply <- header:
+			default:
+			}
+		}
+		return id, nil
+	}
+
+	// Like a Shared subscription, each subscription name receives the message once. Paused
+	// subscriptions hold on to it until they are resumed.
+	var targets []*listener
+	seen := make(map[string]bool)
+	for _, l := range c.listeners {
+		if !seen[l.subscription] && l.matches(topic) {
+			seen[l.subscription] = true
+			if l.paused {
+				l.held = append(l.held, m)
+			} else {
+				targets = append(targets, l)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	for _, l := range targets {
+		c.dispatch(l, m)
+	}
+	return id, nil
+}
+
+// dispatch delivers m to l, on its own goroutine with asynchronous delivery.
+func (c *Client) dispatch(l *listener, m *message) {
+	if c.async {
+		c.inflight.Add(1)
+		go func() {
+			defer c.inflight.Done()
+			c.deliver(l, m)
+		}()
+		return
+	}
+	c.deliver(l, m)
+}
+
+// deliver hands m to the listener until it is acked or dead-lettered.
+func (c *Client) deliver(l *listener, m *message) {
+	for {
+		ctx, header, reason, err := c.decode(context.WithoutCancel(l.ctx), m)
+		if err != nil {
+			c.deadLetter(m, reason, err)
+			return
+		}
+
+		err = dispatch.Handle(ctx, l.handler, m, header)
+		if err == nil {
+			c.mu.Lock()
+			c.acked++
+			c.mu.Unlock()
+			return
+		}
+		if reason, ok := pulsarClient.DeadLetterReason(err); ok {
+			c.deadLetter(m, reason, err)
+			return
+		}
+		if int(m.redeliveryCount)+1 >= c.maxDeliveries {
+			c.deadLetter(m, "max_deliveries_exceeded", err)
+			return
+		}
+
+		c.mu.Lock()
+		c.nacked++
+		c.mu.Unlock()
+		if delay, found := pulsarClient.NackDelay(err); found && c.async {
+			time.Sleep(delay)
+		}
+		m = m.redelivered()
+	}
+}
+
+// decode parses m and applies its topic's schema. On failure it returns the dead-letter reason.
+func (c *Client) decode(ctx context.Context, m *message) (context.Context, *pulsarClient.EventHeader, string, error) {
+	header, err := sysResponse.ParseEventHeader(m.payload)
+	if err != nil {
+		return ctx, nil, "unparseable_payload", err
+	}
+	if version := pulsarClient.MessageEventVersion(m); version < c.upcasters.LatestVersion(header.EventType) {
+		event, err := c.upcasters.Upcast(header.EventType, version, m.payload)
+		if err != nil {
+			return ctx, nil, "upcast_failed", err
+		}
+		if header, err = sysResponse.ParseEventHeader(event); err != nil {
+			return ctx, nil, "upcast_failed", err
+		}
+	}
+	if schema := c.schemaFor(m.topic); schema != nil {
+		raw, err := json.Marshal(header.Payload)
+		if err != nil {
+			return ctx, nil, "schema_violation", err
+		}
+		payload, err := schema.Decode(raw)
+		if err != nil {
+			return ctx, nil, "schema_violation", err
+		}
+		ctx = dispatch.WithPayload(ctx, payload)
+	}
+	return ctx, header, "", nil
+}
+
+func (c *Client) deadLetter(m *message, reason string, cause error) {
+	topic := partitionSuffix.ReplaceAllString(m.topic, "")
+	dlqMessage := pulsarClient.DLQMessage{
+		ID:                m.id,
+		MessageID:         m.id.String(),
+		Reason:            reason,
+		ErrorDetail:       cause.Error(),
+		OriginalTopic:     topic,
+		OriginalMessageID: m.id.String(),
+		Key:               m.key,
+		OrderingKey:       m.orderingKey,
+		EventTime:         m.eventTime,
+		PublishTime:       time.Now(),
+		Properties:        m.properties,
+		Payload:           m.payload,
+	}
+	if header, err := sysResponse.ParseEventHeader(m.payload); err == nil {
+		dlqMessage.EventType = header.EventType
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadLetters[topic+dlqSuffix] = append(c.deadLetters[topic+dlqSuffix], dlqMessage)
+}
+
+// remove deletes messages from dlqTopic and returns how many were found.
+func (c *Client) remove(dlqTopic string, messages []pulsarClient.DLQMessage) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for _, target := range messages {
+		current := c.deadLetters[dlqTopic]
+		for i := range current {
+			if current[i].MessageID == target.MessageID {
+				c.deadLetters[dlqTopic] = slices.Delete(current, i, i+1)
+				removed++
+				break
+			}
+		}
+	}
+	return removed
+}
+
+// dlqBrowser is the in-memory DLQBrowser.
+type dlqBrowser struct {
+	client *Client
+	topic  string
+}
+
+func (b *dlqBrowser) List(_ context.Context, filter pulsarClient.DLQFilter) ([]pulsarClient.DLQMessage, error) {
+	var messages []pulsarClient.DLQMessage
+	for _, message := range b.client.DeadLettered(b.topic) {
+		if filter.Limit > 0 && len(messages) >= filter.Limit {
+			break
+		}
+		if len(filter.Reasons) > 0 && !slices.Contains(filter.Reasons, message.Reason) ||
+			len(filter.EventTypes) > 0 && !slices.Contains(filter.EventTypes, message.EventType) ||
+			!filter.From.IsZero() && message.PublishTime.Before(filter.From) ||
+			!filter.To.IsZero() && message.PublishTime.After(filter.To) {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+func (b *dlqBrowser) Replay(ctx context.Context, targetTopic string, messages ...pulsarClient.DLQMessage) (int, error) {
+	replayed := 0
+	var errs []error
+	for _, message := range messages {
+		if b.client.remove(b.topic, []pulsarClient.DLQMessage{message}) == 0 {
+			errs = append(errs, fmt.Errorf("message %s is not in DLQ %s", message.MessageID, b.topic))
+			continue
+		}
+		topic := targetTopic
+		if topic == "" {
+			topic = strings.TrimSuffix(message.OriginalTopic, dlqSuffix)
+		}
+		if _, err := b.client.send(ctx, topic, message.EventType, nil, &pulsar.ProducerMessage{
+			Payload:     message.Payload,
+			Key:         message.Key,
+			OrderingKey: message.OrderingKey,
+			EventTime:   message.EventTime,
+			Properties:  message.Properties,
+		}); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		replayed++
+	}
+	return replayed, errors.Join(errs...)
+}
+
+func (b *dlqBrowser) Discard(_ context.Context, messages ...pulsarClient.DLQMessage) (int, error) {
+	return b.client.remove(b.topic, messages), nil
+}
+
+func (b *dlqBrowser) Export(_ context.Context, path string, messages ...pulsarClient.DLQMessage) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	for _, message := range messages {
+		if err := encoder.Encode(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package pulsartest_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	sysResponse "github.com/factory24/flow-system/pkg/response"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+
+	pulsarClient "github.com/factory24/athari-thirdparty/pulsar"
+	"github.com/factory24/athari-thirdparty/pulsar/pulsartest"
+)
+
+const ordersTopic = "persistent://public/default/orders"
+
+type order struct {
+	ID     string `json:"id"`
+	Amount int    `json:"amount"`
+}
+
+const orderDefinition = `{
+	"type": "record",
+	"name": "Order",
+	"fields": [
+		{"name": "id", "type": "string"},
+		{"name": "amount", "type": "int"}
+	]
+}`
+
+// recorder is a MessageHandler that answers every delivery with the next outcome, acking once
+// they run out, and records what it was handed.
+type recorder struct {
+	mu       sync.Mutex
+	outcomes []pulsarClient.Outcome
+	events   []string
+	topics   []string
+	keys     []string
+	payloads []any
+}
+
+func (r *recorder) HandleEvent(header *pulsarClient.EventHeader) error {
+	return errors.New("HandleEvent called instead of HandleMessage")
+}
+
+func (r *recorder) HandleMessage(mc *pulsarClient.MessageContext, header *pulsarClient.EventHeader) pulsarClient.Outcome {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, header.EventType)
+	r.topics = append(r.topics, pulsarClient.MessageTopic(mc))
+	r.keys = append(r.keys, mc.Key())
+	if payload, found := pulsarClient.EventPayload(mc); found {
+		r.payloads = append(r.payloads, payload)
+	}
+	if len(r.outcomes) == 0 {
+		return pulsarClient.Ack()
+	}
+	outcome := r.outcomes[0]
+	r.outcomes = r.outcomes[1:]
+	return outcome
+}
+
+func listen(t *testing.T, client *pulsartest.Client, topic string, handler pulsarClient.EventHandler) {
+	t.Helper()
+	if _, err := client.ListenOnTopics(context.Background(), []string{topic}, "billing", handler); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishAndListen(t *testing.T) {
+	client := pulsartest.NewClient()
+	handler := &recorder{}
+	listen(t, client, "orders", handler)
+	other := &recorder{}
+	listen(t, client, "invoices", other)
+
+	ctx := context.Background()
+	if err := client.PublishEvent(ctx, ordersTopic, "order.created", order{ID: "o-1"}, pulsarClient.WithKey("customer-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PublishEvent(ctx, "orders", "order.paid", order{ID: "o-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handler.events) != 2 || handler.events[0] != "order.created" || handler.events[1] != "order.paid" {
+		t.Fatalf("handler received %v", handler.events)
+	}
+	if handler.topics[0] != ordersTopic || handler.keys[0] != "customer-1" {
+		t.Fatalf("handler saw topic %q and key %q", handler.topics[0], handler.keys[0])
+	}
+	if len(other.events) != 0 {
+		t.Fatalf("listener on another topic received %v", other.events)
+	}
+
+	// Short and qualified names refer to the same topic.
+	if short, qualified := client.PublishedTo("orders"), client.PublishedTo(ordersTopic); len(short) != 2 || len(qualified) != 2 {
+		t.Fatalf("PublishedTo found %d and %d events", len(short), len(qualified))
+	}
+	var decoded order
+	if err := client.PublishedOfType("order.created")[0].Decode(&decoded); err != nil || decoded.ID != "o-1" {
+		t.Fatalf("Decode = %+v, %v", decoded, err)
+	}
+	if client.Acked() != 2 || client.Nacked() != 0 {
+		t.Fatalf("acked %d, nacked %d", client.Acked(), client.Nacked())
+	}
+}
+
+func TestNackRedelivers(t *testing.T) {
+	client := pulsartest.NewClient()
+	handler := &recorder{outcomes: []pulsarClient.Outcome{
+		pulsarClient.Nack(errors.New("database down")),
+		pulsarClient.Nack(errors.New("database down")),
+	}}
+	listen(t, client, "orders", handler)
+
+	if err := client.PublishEvent(context.Background(), "orders", "order.created", order{ID: "o-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(handler.events) != 3 {
+		t.Fatalf("handler called %d times, want 3", len(handler.events))
+	}
+	if client.Nacked() != 2 || client.Acked() != 1 {
+		t.Fatalf("acked %d, nacked %d", client.Acked(), client.Nacked())
+	}
+	if dead := client.DeadLettered("orders.dead_letter"); len(dead) != 0 {
+		t.Fatalf("acked event dead-lettered: %+v", dead)
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	client := pulsartest.NewClient(pulsartest.WithMaxDeliveries(2))
+	failing := errors.New("invalid order")
+	handler := &recorder{outcomes: []pulsarClient.Outcome{
+		pulsarClient.Nack(failing),
+		pulsarClient.Nack(failing),
+		pulsarClient.DeadLetter("rejected", failing),
+	}}
+	listen(t, client, "orders", handler)
+
+	ctx := context.Background()
+	if err := client.PublishEvent(ctx, "orders", "order.created", order{ID: "o-1"}, pulsarClient.WithKey("customer-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PublishEvent(ctx, "orders", "order.cancelled", order{ID: "o-2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dead := client.DeadLettered("orders.dead_letter")
+	if len(dead) != 2 {
+		t.Fatalf("dead letters = %+v, want 2", dead)
+	}
+	if dead[0].Reason != "max_deliveries_exceeded" || dead[0].EventType != "order.created" ||
+		dead[0].Key != "customer-1" || dead[0].OriginalTopic != ordersTopic {
+		t.Fatalf("first dead letter %+v", dead[0])
+	}
+	if dead[1].Reason != "rejected" || dead[1].ErrorDetail == "" {
+		t.Fatalf("second dead letter %+v", dead[1])
+	}
+
+	browser := client.DLQ(ordersTopic+".dead_letter", "billing")
+	rejected, err := browser.List(ctx, pulsarClient.DLQFilter{Reasons: []string{"rejected"}})
+	if err != nil || len(rejected) != 1 {
+		t.Fatalf("List = %+v, %v", rejected, err)
+	}
+	if replayed, err := browser.Replay(ctx, "", rejected...); err != nil || replayed != 1 {
+		t.Fatalf("Replay = %d, %v", replayed, err)
+	}
+	if last := handler.events[len(handler.events)-1]; last != "order.cancelled" {
+		t.Fatalf("replayed event handled as %q", last)
+	}
+	if remaining := client.DeadLettered(ordersTopic + ".dead_letter"); len(remaining) != 1 {
+		t.Fatalf("%d dead letters left after replay, want 1", len(remaining))
+	}
+}
+
+func TestSchemaRejectsInvalidPayloads(t *testing.T) {
+	client := pulsartest.NewClient()
+	schema, err := pulsarClient.NewJSONSchema[order](orderDefinition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Registered under the qualified name, published and consumed under the short one.
+	if err := client.RegisterSchema(ordersTopic, schema); err != nil {
+		t.Fatal(err)
+	}
+	handler := &recorder{}
+	listen(t, client, "orders", handler)
+
+	ctx := context.Background()
+	if err := client.PublishEvent(ctx, "orders", "order.created", order{ID: "o-1", Amount: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if len(handler.payloads) != 1 || handler.payloads[0] != (order{ID: "o-1", Amount: 5}) {
+		t.Fatalf("handler received payloads %#v", handler.payloads)
+	}
+
+	err = client.PublishEvent(ctx, "orders", "order.created", map[string]any{"id": "o-2"})
+	if !errors.Is(err, pulsarClient.ErrSchemaViolation) {
+		t.Fatalf("publishing an invalid payload returned %v", err)
+	}
+	if published := client.PublishedTo("orders"); len(published) != 1 {
+		t.Fatalf("invalid payload recorded: %d events", len(published))
+	}
+
+	// A message that bypasses PublishEvent is checked on delivery instead.
+	data, err := sysResponse.NewEvent("orders", "order.created", map[string]any{"id": 7}).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer, err := client.GetOrCreateProducer("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := producer.Send(ctx, &pulsar.ProducerMessage{Payload: data}); err != nil {
+		t.Fatal(err)
+	}
+	dead := client.DeadLettered("orders.dead_letter")
+	if len(dead) != 1 || dead[0].Reason != "schema_violation" {
+		t.Fatalf("dead letters = %+v", dead)
+	}
+	if len(handler.events) != 1 {
+		t.Fatalf("handler called %d times, want 1", len(handler.events))
+	}
+}
@@ -0,0 +1,83 @@
+package pulsartest
+
+import (
+	"fmt"
+
+	pulsarClient "github.com/factory24/athari-thirdparty/pulsar"
+)
+
+// Subscription is the pulsarClient.Subscription returned by the fake client. Pausing holds back
+// deliveries until Resume; the rate limit and worker count are recorded for assertions but do not
+// change how events are delivered.
+type Subscription struct {
+	client   *Client
+	listener *listener
+}
+
+var _ pulsarClient.Subscription = (*Subscription)(nil)
+
+func (s *Subscription) Name() string {
+	return s.listener.subscription
+}
+
+func (s *Subscription) Pause() {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	s.listener.paused = true
+}
+
+// Resume delivers the events held back while paused, in publish order.
+func (s *Subscription) Resume() {
+	s.client.mu.Lock()
+	s.listener.paused = false
+	held := s.listener.held
+	s.listener.held = nil
+	s.client.mu.Unlock()
+
+	for _, m := range held {
+		s.client.dispatch(s.listener, m)
+	}
+}
+
+func (s *Subscription) Paused() bool {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	return s.listener.paused
+}
+
+// Held returns the number of events waiting for the subscription to resume.
+func (s *Subscription) Held() int {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	return len(s.listener.held)
+}
+
+func (s *Subscription) SetRateLimit(eventsPerSecond float64, burst int) {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	s.listener.rateLimit = eventsPerSecond
+	s.listener.rateBurst = burst
+}
+
+// RateLimit returns the limit last set with SetRateLimit.
+func (s *Subscription) RateLimit() (eventsPerSecond float64, burst int) {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	return s.listener.rateLimit, s.listener.rateBurst
+}
+
+func (s *Subscription) SetWorkerCount(workers int) error {
+	if workers < 1 {
+		return fmt.Errorf("invalid worker count %d for subscription %s", workers, s.listener.subscription)
+	}
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	s.listener.workers = workers
+	return nil
+}
+
+func (s *Subscription) WorkerCount() int {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	return s.listener.workers
+}
@@ -0,0 +1,144 @@
+package pulsarClient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sysResponse "github.com/factory24/flow-system/pkg/response"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+
+	"github.com/factory24/athari-thirdparty/pulsar/internal/dispatch"
+)
+
+const defaultReplayProgressEvery = 1000
+
+// ReplayOptions controls a ReplayTopic run. The zero value replays from the earliest retained
+// message up to the moment the replay starts.
+type ReplayOptions struct {
+	// StartMessageID resumes after this message, e.g. ReplayProgress.LastMessageID of an earlier
+	// run. It takes precedence over StartTime.
+	StartMessageID pulsar.MessageID
+	// StartTime starts at the first message published at or after this time.
+	StartTime time.Time
+	// StopTime ends the replay at the first message published after it. It defaults to the
+	// start of the replay, so events published while it runs are left to live subscriptions.
+	StopTime time.Time
+	// SkipFailed logs and counts handler errors instead of stopping the replay at the first one.
+	SkipFailed bool
+	// Progress, if set, is called every ProgressEvery messages (default 1000) and once at the end.
+	Progress      func(ReplayProgress)
+	ProgressEvery int
+}
+
+// ReplayProgress reports how far a replay has got. LastMessageID can be passed back as
+// ReplayOptions.StartMessageID to resume an interrupted replay.
+type ReplayProgress struct {
+	Topic           string
+	Processed       int
+	Failed          int
+	LastMessageID   pulsar.MessageID
+	LastPublishTime time.Time
+	Elapsed         time.Duration
+	Done            bool
+}
+
+// ReplayTopic reads topic from the position in options with a non-durable reader, so live
+// subscriptions and their cursors are untouched, and feeds every event to handler exactly as
+// ListenOnTopics would: headers are parsed, messages are decrypted and topic schemas applied.
+// It returns when the stop time or the end of the topic is reached, ctx ends, or a handler fails
+// and SkipFailed is false.
+func (p *pulsarClient) ReplayTopic(ctx context.Context, topic string, handler EventHandler, options ReplayOptions) (ReplayProgress, error) {
+	started := time.Now()
+	progress := ReplayProgress{Topic: topic}
+	stopTime := options.StopTime
+	if stopTime.IsZero() {
+		stopTime = started
+	}
+	progressEvery := options.ProgressEvery
+	if progressEvery <= 0 {
+		progressEvery = defaultReplayProgressEvery
+	}
+	report := func(done bool) {
+		progress.Elapsed = time.Since(started)
+		progress.Done = done
+		if options.Progress != nil {
+			options.Progress(progress)
+		}
+	}
+
+	startMessageID := pulsar.EarliestMessageID()
+	if options.StartMessageID != nil {
+		startMessageID = options.StartMessageID
+	}
+	reader, err := p.active().CreateReader(pulsar.ReaderOptions{
+		Topic:          topic,
+		StartMessageID: startMessageID,
+		Decryption: &pulsar.MessageDecryptionInfo{
+			KeyReader:                   p.keyReader,
+			MessageCrypto:               nil,
+			ConsumerCryptoFailureAction: 1,
+		},
+	})
+	if err != nil {
+		return progress, fmt.Errorf("failed to create reader for topic %s: %w", topic, err)
+	}
+	defer reader.Close()
+
+	if options.StartMessageID == nil && !options.StartTime.IsZero() {
+		if err := reader.SeekByTime(options.StartTime); err != nil {
+			return progress, fmt.Errorf("failed to seek topic %s to %s: %w", topic, options.StartTime, err)
+		}
+	}
+
+	PulsarLogInfo("Replaying topic %s up to %s", topic, stopTime.Format(time.RFC3339))
+	for reader.HasNext() {
+		msg, err := reader.Next(ctx)
+		if err != nil {
+			report(false)
+			return progress, fmt.Errorf("replay of topic %s interrupted: %w", topic, err)
+		}
+		if msg.PublishTime().After(stopTime) {
+			break
+		}
+
+		if err := p.replayMessage(ctx, handler, msg); err != nil {
+			progress.Failed++
+			if !options.SkipFailed {
+				report(false)
+				return progress, fmt.Errorf("replay of topic %s stopped at message %v: %w", topic, msg.ID(), err)
+			}
+			PulsarLogError("Replay of message %v on topic %s failed, skipping: %v", msg.ID(), topic, err)
+		}
+		progress.Processed++
+		progress.LastMessageID = msg.ID()
+		progress.LastPublishTime = msg.PublishTime()
+		if progress.Processed%progressEvery == 0 {
+			report(false)
+		}
+	}
+
+	report(true)
+	PulsarLogSuccess("Replayed %d message(s) from topic %s (%d failed) in %s", progress.Processed, topic, progress.Failed, progress.Elapsed.Round(time.Millisecond))
+	return progress, nil
+}
+
+// replayMessage parses msg and hands it to handler, applying the topic's schema if one is registered.
+func (p *pulsarClient) replayMessage(ctx context.Context, handler EventHandler, msg pulsar.Message) error {
+	header, err := sysResponse.ParseEventHeader(msg.Payload())
+	if err != nil {
+		return fmt.Errorf("failed to parse event header: %w", err)
+	}
+	if header, err = p.upcasters.upcastHeader(msg, header); err != nil {
+		return err
+	}
+	if schema := p.schemaFor(sourceTopic(msg)); schema != nil {
+		payload, err := decodeWithSchema(schema, header)
+		if err != nil {
+			return err
+		}
+		ctx = dispatch.WithPayload(ctx, payload)
+	}
+	return dispatchEvent(ctx, handler, msg, header)
+}
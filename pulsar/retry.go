@@ -0,0 +1,118 @@
+package pulsarClient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+const (
+	defaultRetrySuffix = ".retry"
+
+	retryCountProperty    = "retry_count"
+	retryTopicProperty    = "retry_original_topic"
+	retryHistoryProperty  = "retry_history"
+	maxRetryErrorLength   = 512
+	maxRetryHistoryLength = 20
+)
+
+// DefaultRetrySchedule is a retry schedule suited to riding out short downstream outages.
+var DefaultRetrySchedule = []time.Duration{5 * time.Second, 30 * time.Second, 2 * time.Minute, 10 * time.Minute}
+
+// WithRetrySchedule routes failed events through "<topic>.retry" instead of nacking them. The n-th
+// failure republishes the event with a delay of delays[n-1] and an incremented retry_count
+// property; once the schedule is used up the event goes to the DLQ with its failure history.
+// The subscription also consumes the retry topics, so it must be Shared or KeyShared, and a
+// ListenOnPattern pattern must match the retry topics too.
+func WithRetrySchedule(delays ...time.Duration) ConsumerOption {
+	return func(cfg *consumerConfig) {
+		cfg.retrySchedule = delays
+	}
+}
+
+// retryFailure is one entry of the retry_history property.
+type retryFailure struct {
+	Attempt  int       `json:"attempt"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// sourceTopic returns the topic an event was originally published to, looking through retry topics.
+func sourceTopic(msg pulsar.Message) string {
+	if topic, found := msg.Properties()[retryTopicProperty]; found {
+		return topic
+	}
+	return baseTopic(msg.Topic())
+}
+
+// retryCount returns how many times an event has already been sent through the retry topic.
+func retryCount(msg pulsar.Message) int {
+	count, err := strconv.Atoi(msg.Properties()[retryCountProperty])
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// scheduleRetry republishes msg to the retry topic of its source topic, delayed according to the
+// subscription's schedule unless the handler asked for a delay of its own. It reports false when
+// the schedule is exhausted.
+func (p *pulsarClient) scheduleRetry(sub *subscription, msg pulsar.Message, handlerErr error) (bool, error) {
+	attempt := retryCount(msg)
+	if attempt >= len(sub.cfg.retrySchedule) {
+		return false, nil
+	}
+	topic := sourceTopic(msg)
+	retryTopic := topic + defaultRetrySuffix
+	delay := sub.cfg.retrySchedule[attempt]
+	if requested, found := NackDelay(handlerErr); found {
+		delay = requested
+	}
+
+	properties := make(map[string]string, len(msg.Properties())+3)
+	for k, v := range msg.Properties() {
+		properties[k] = v
+	}
+	properties[retryCountProperty] = strconv.Itoa(attempt + 1)
+	properties[retryTopicProperty] = topic
+	properties[retryHistoryProperty] = appendRetryHistory(properties[retryHistoryProperty], attempt+1, handlerErr)
+
+	producer, err := p.getOrCreateProducer(retryTopic, p.producerOptionsFor(topic))
+	if err != nil {
+		return true, fmt.Errorf("failed to get producer for retry topic %s: %w", retryTopic, err)
+	}
+	if _, err := producer.Send(context.Background(), &pulsar.ProducerMessage{
+		Payload:     msg.Payload(),
+		Key:         msg.Key(),
+		OrderingKey: msg.OrderingKey(),
+		EventTime:   msg.EventTime(),
+		Properties:  properties,
+		DeliverAt:   time.Now().Add(delay),
+	}); err != nil {
+		return true, fmt.Errorf("failed to publish message to retry topic %s: %w", retryTopic, err)
+	}
+	PulsarLogInfo("Scheduled retry %d/%d of message %v on %s in %s", attempt+1, len(sub.cfg.retrySchedule), msg.ID(), retryTopic, delay)
+	return true, nil
+}
+
+// appendRetryHistory adds a failure to the JSON history, keeping only the most recent entries.
+func appendRetryHistory(history string, attempt int, handlerErr error) string {
+	var failures []retryFailure
+	if history != "" {
+		_ = json.Unmarshal([]byte(history), &failures)
+	}
+	detail := handlerErr.Error()
+	if len(detail) > maxRetryErrorLength {
+		detail = detail[:maxRetryErrorLength]
+	}
+	failures = append(failures, retryFailure{Attempt: attempt, Error: detail, FailedAt: time.Now().UTC()})
+	if len(failures) > maxRetryHistoryLength {
+		failures = failures[len(failures)-maxRetryHistoryLength:]
+	}
+	encoded, _ := json.Marshal(failures)
+	return string(encoded)
+}
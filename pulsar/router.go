@@ -0,0 +1,148 @@
+package pulsarClient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// UnknownEventPolicy decides what a Router does with events that no registered route matches.
+type UnknownEventPolicy int
+
+const (
+	// UnknownEventAck acknowledges and drops unmatched events.
+	UnknownEventAck UnknownEventPolicy = iota
+	// UnknownEventNack nacks unmatched events so they are redelivered, e.g. to a newer deployment.
+	UnknownEventNack
+	// UnknownEventDeadLetter sends unmatched events to the subscription's DLQ.
+	UnknownEventDeadLetter
+)
+
+// ErrUnknownEvent is returned (wrapped) by a Router for events no route matches.
+var ErrUnknownEvent = errors.New("no route registered for event type")
+
+type routeKey struct {
+	topic     string
+	eventType string
+}
+
+type routeFunc func(ctx context.Context, header *EventHeader) error
+
+// Router is an EventHandler that dispatches events to handlers registered per event type and,
+// optionally, per topic. Register routes with On and OnTopic before passing it to ListenOnTopics.
+type Router struct {
+	mu            sync.RWMutex
+	routes        map[routeKey]routeFunc
+	unknownPolicy UnknownEventPolicy
+}
+
+// NewRouter creates an empty Router that treats unmatched events according to policy.
+func NewRouter(policy UnknownEventPolicy) *Router {
+	return &Router{
+		routes:        make(map[routeKey]routeFunc),
+		unknownPolicy: policy,
+	}
+}
+
+// On registers fn for eventType on every topic. The event payload is decoded into T before fn is called.
+func On[T any](r *Router, eventType string, fn func(ctx context.Context, header *EventHeader, payload T) error) {
+	OnTopic(r, "", eventType, fn)
+}
+
+// OnTopic registers fn for eventType on a single topic. Short names are resolved like producer
+// topics (persistent://public/default), and events match on the topic they were published to,
+// whichever partition or retry topic delivers them. Topic-specific routes take precedence over On
+// routes.
+func OnTopic[T any](r *Router, topic, eventType string, fn func(ctx context.Context, header *EventHeader, payload T) error) {
+	if topic != "" {
+		topic = qualifiedTopic(topic)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes[routeKey{topic: topic, eventType: eventType}] = func(ctx context.Context, header *EventHeader) error {
+		if decoded, ok := EventPayload(ctx); ok {
+			if payload, ok := decoded.(T); ok {
+				return fn(ctx, header, payload)
+			}
+		}
+		var payload T
+		if err := decodePayload(header, &payload); err != nil {
+			// A payload that does not fit T will never decode on redelivery either.
+			return &deadLetterError{reason: "payload_decode_failed", err: err}
+		}
+		return fn(ctx, header, payload)
+	}
+}
+
+// HandleEvent implements EventHandler. Topic-specific routes are only matched through HandleEventContext.
+func (r *Router) HandleEvent(header *EventHeader) error {
+	return r.HandleEventContext(context.Background(), header)
+}
+
+// HandleEventContext implements ContextEventHandler.
+func (r *Router) HandleEventContext(ctx context.Context, header *EventHeader) error {
+	topic := MessageTopic(ctx)
+	if topic != "" {
+		topic = qualifiedTopic(topic)
+	}
+
+	r.mu.RLock()
+	route, found := r.routes[routeKey{topic: topic, eventType: header.EventType}]
+	if !found {
+		route, found = r.routes[routeKey{eventType: header.EventType}]
+	}
+	r.mu.RUnlock()
+
+	if found {
+		return route(ctx, header)
+	}
+
+	err := fmt.Errorf("%w '%s' on topic '%s'", ErrUnknownEvent, header.EventType, topic)
+	switch r.unknownPolicy {
+	case UnknownEventNack:
+		return err
+	case UnknownEventDeadLetter:
+		return &deadLetterError{reason: "unknown_event_type", err: err}
+	default:
+		PulsarLogInfo("Ignoring event '%s' on topic '%s': no route registered", header.EventType, topic)
+		return nil
+	}
+}
+
+// decodePayload re-encodes the flow-system payload and decodes it into target.
+func decodePayload(header *EventHeader, target any) error {
+	raw, err := json.Marshal(header.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload of event '%s': %w", header.EventType, err)
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		return fmt.Errorf("failed to decode payload of event '%s' into %T: %w", header.EventType, target, err)
+	}
+	return nil
+}
+
+// deadLetterError tells processMessage to dead-letter a message instead of nacking it.
+type deadLetterError struct {
+	reason string
+	err    error
+}
+
+func (e *deadLetterError) Error() string {
+	return fmt.Sprintf("%s: %v", e.reason, e.err)
+}
+
+func (e *deadLetterError) Unwrap() error {
+	return e.err
+}
+
+// DeadLetterReason reports whether a handler error asks for the message to be dead-lettered
+// rather than nacked, and with which reason.
+func DeadLetterReason(err error) (string, bool) {
+	var dlErr *deadLetterError
+	if errors.As(err, &dlErr) {
+		return dlErr.reason, true
+	}
+	return "", false
+}
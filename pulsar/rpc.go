@@ -0,0 +1,384 @@
+package pulsarClient
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	sysResponse "github.com/factory24/flow-system/pkg/response"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+
+	"github.com/factory24/athari-thirdparty/pulsar/internal/dispatch"
+)
+
+const (
+	// ReplyToProperty names the topic a request expects its reply on.
+	ReplyToProperty = dispatch.ReplyToProperty
+	// CorrelationIDProperty ties a reply to the request it answers.
+	CorrelationIDProperty = dispatch.CorrelationIDProperty
+
+	defaultRequestTimeout = 30 * time.Second
+	// maxReplyProducers is how many reply topics keep an open producer. Every requesting instance
+	// has its own reply topic, so the least recently answered ones are closed beyond that.
+	maxReplyProducers = 32
+)
+
+var (
+	// ErrRequestTimeout is returned (wrapped) by Request when no reply arrives in time.
+	ErrRequestTimeout = errors.New("timed out waiting for reply")
+	// ErrNotARequest is returned by Reply when the event being handled carries no reply address.
+	ErrNotARequest = errors.New("event being handled is not a request")
+)
+
+// WithReplyTopic sets the topic this instance receives replies on. It must be unique per
+// instance. By default a non-persistent topic named after APP.SERVICE.NAME and a random suffix
+// is used.
+func WithReplyTopic(topic string) ClientOption {
+	return func(p *pulsarClient) {
+		p.replyTopic = topic
+	}
+}
+
+// WithRequestTimeout sets how long Request waits for a reply when ctx has no earlier deadline.
+// The default is 30 seconds.
+func WithRequestTimeout(timeout time.Duration) ClientOption {
+	return func(p *pulsarClient) {
+		if timeout > 0 {
+			p.requestTimeout = timeout
+		}
+	}
+}
+
+// ReplyAddress returns the reply topic and correlation ID of the request being handled, or false
+// when the event is not a request or ctx does not come from a handler.
+func ReplyAddress(ctx context.Context) (replyTo, correlationID string, ok bool) {
+	msg := messageFromContext(ctx)
+	if msg == nil {
+		return "", "", false
+	}
+	replyTo = msg.Properties()[ReplyToProperty]
+	correlationID = msg.Properties()[CorrelationIDProperty]
+	return replyTo, correlationID, replyTo != "" && correlationID != ""
+}
+
+// requestOptions returns opts followed by the properties that turn an event into a request.
+func requestOptions(replyTo, correlationID string, opts []PublishOption) []PublishOption {
+	return append(append([]PublishOption(nil), opts...), WithProperties(dispatch.RequestProperties(replyTo, correlationID)))
+}
+
+// replyOptions returns opts followed by the property that marks an event as the reply to correlationID.
+func replyOptions(correlationID string, opts []PublishOption) []PublishOption {
+	return append(append([]PublishOption(nil), opts...), WithProperties(dispatch.ReplyProperties(correlationID)))
+}
+
+// replyListener consumes the reply topic of one client and hands each reply to the Request
+// waiting for its correlation ID.
+type replyListener struct {
+	topic    string
+	consumer pulsar.Consumer
+	cancel   context.CancelFunc
+
+	mu      sync.Mutex
+	pending map[string]chan *EventHeader
+}
+
+// expect registers a waiter for correlationID. Call forget once it is no longer waiting.
+func (r *replyListener) expect(correlationID string) <-chan *EventHeader {
+	ch := make(chan *EventHeader, 1)
+	r.mu.Lock()
+	r.pending[correlationID] = ch
+	r.mu.Unlock()
+	return ch
+}
+
+func (r *replyListener) forget(correlationID string) {
+	r.mu.Lock()
+	delete(r.pending, correlationID)
+	r.mu.Unlock()
+}
+
+func (r *replyListener) run(ctx context.Context) {
+	for {
+		msg, err := r.consumer.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			PulsarLogError("Failed to receive reply on %s: %v", r.topic, err)
+			time.Sleep(time.Second)
+			continue
+		}
+		r.consumer.Ack(msg)
+
+		correlationID := msg.Properties()[CorrelationIDProperty]
+		header, err := sysResponse.ParseEventHeader(msg.Payload())
+		if err != nil {
+			PulsarLogError("Dropping unparseable reply %v (correlation ID: %s): %v", msg.ID(), correlationID, err)
+			continue
+		}
+		r.mu.Lock()
+		ch, found := r.pending[correlationID]
+		r.mu.Unlock()
+		if !found {
+			PulsarLogInfo("Dropping reply '%s' for unknown or expired request %s", header.EventType, correlationID)
+			continue
+		}
+		select {
+		case ch <- header:
+		default:
+			PulsarLogInfo("Dropping duplicate reply '%s' for request %s", header.EventType, correlationID)
+		}
+	}
+}
+
+func (r *replyListener) close() {
+	r.cancel()
+	r.consumer.Close()
+}
+
+// replies returns the client's reply listener, subscribing to the reply topic on first use.
+func (p *pulsarClient) replies() (*replyListener, error) {
+	p.replyMu.Lock()
+	defer p.replyMu.Unlock()
+	if p.replyListener != nil {
+		return p.replyListener, nil
+	}
+
+	serviceName := os.Getenv("APP.SERVICE.NAME")
+	if serviceName == "" {
+		return nil, fmt.Errorf("APP.SERVICE.NAME environment variable not set")
+	}
+	topic := p.replyTopic
+	if topic == "" {
+		topic = fmt.Sprintf("non-persistent://public/default/%s-replies-%s", serviceName, dispatch.NewCorrelationID()[:8])
+	}
+
+	consumer, err := p.active().Subscribe(pulsar.ConsumerOptions{
+		Topic:                       topic,
+		SubscriptionName:            serviceName + "-replies",
+		Type:                        pulsar.Exclusive,
+		SubscriptionInitialPosition: pulsar.SubscriptionPositionLatest,
+		Decryption: &pulsar.MessageDecryptionInfo{
+			KeyReader:                   p.keyReader,
+			MessageCrypto:               nil,
+			ConsumerCryptoFailureAction: 1,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not subscribe to reply topic %s: %w", topic, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	listener := &replyListener{
+		topic:    topic,
+		consumer: consumer,
+		cancel:   cancel,
+		pending:  make(map[string]chan *EventHeader),
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		listener.close()
+		return nil, ErrClientClosed
+	}
+	p.replyListener = listener
+	p.mu.Unlock()
+
+	go listener.run(ctx)
+	PulsarLogSuccess("Listening for replies on %s", topic)
+	return listener, nil
+}
+
+// Request publishes a request event to topic and waits for the handler's Reply. It gives up with
+// ErrRequestTimeout after the request timeout or when ctx expires, whichever comes first.
+func (p *pulsarClient) Request(ctx context.Context, topic, eventType string, payload any, opts ...PublishOption) (*EventHeader, error) {
+	replies, err := p.replies()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := p.requestTimeout
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	correlationID := dispatch.NewCorrelationID()
+	reply := replies.expect(correlationID)
+	defer replies.forget(correlationID)
+
+	if err := p.PublishEvent(ctx, topic, eventType, payload, requestOptions(replies.topic, correlationID, opts)...); err != nil {
+		return nil, fmt.Errorf("failed to send request '%s' to topic %s: %w", eventType, topic, err)
+	}
+
+	select {
+	case header := <-reply:
+		return header, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("request '%s' to topic %s (correlation ID: %s): %w", eventType, topic, correlationID, ErrRequestTimeout)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Reply answers the request being handled. Call it from a ContextEventHandler or Router route
+// with the ctx it was given; it returns ErrNotARequest if the event carries no reply address.
+func (p *pulsarClient) Reply(ctx context.Context, eventType string, payload any, opts ...PublishOption) (err error) {
+	replyTo, correlationID, ok := ReplyAddress(ctx)
+	if !ok {
+		return ErrNotARequest
+	}
+	ctx, span := p.startPublishSpan(ctx, replyTo, eventType)
+	defer func() { endSpan(span, err) }()
+
+	payloadBytes, err := p.encodeWithSchema(replyTo, eventType, payload)
+	if err != nil {
+		p.metrics.publishFailed(replyTo, eventType)
+		return err
+	}
+
+	producer, err := p.replyProducer(replyTo)
+	if err != nil {
+		p.metrics.publishFailed(replyTo, eventType)
+		return fmt.Errorf("failed to get producer for reply topic %s: %w", replyTo, err)
+	}
+
+	message := newProducerMessage(payloadBytes, replyOptions(correlationID, opts))
+	stampEventVersion(p.upcasters, eventType, message)
+	injectTraceContext(ctx, message)
+	_, err = producer.Send(ctx, message)
+	p.metrics.publishAttempt(replyTo, eventType, err)
+	if err != nil {
+		// The next reply to this topic gets a new producer.
+		p.replyProducers.remove(replyTo, producer)
+		p.metrics.publishFailed(replyTo, eventType)
+		return fmt.Errorf("failed to send reply '%s' to topic %s: %w", eventType, replyTo, err)
+	}
+	PulsarLogInfo("Replied with event '%s' on topic '%s'", eventType, replyTo)
+	return nil
+}
+
+// replyProducer returns the producer for the reply topic, creating it on the active client. Reply
+// producers are left unnamed, so the broker gives every one of them a unique name.
+func (p *pulsarClient) replyProducer(topic string) (pulsar.Producer, error) {
+	p.mu.RLock()
+	closed, client := p.closed, p.active()
+	p.mu.RUnlock()
+	if closed {
+		return nil, ErrClientClosed
+	}
+	if producer, found := p.replyProducers.get(client, topic); found {
+		return producer, nil
+	}
+	producer, err := p.createNamedProducer(client, topic, "", p.producerOptionsFor(topic))
+	if err != nil {
+		return nil, err
+	}
+	return p.replyProducers.add(client, topic, producer), nil
+}
+
+// replyProducers holds the producers Reply sends on, apart from p.producers so that the reply
+// topics of requesters that went away do not keep producers open for the life of the client. At
+// most maxReplyProducers are kept, closing the least recently used first.
+type replyProducers struct {
+	mu      sync.Mutex
+	client  pulsar.Client
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type replyProducer struct {
+	topic    string
+	producer pulsar.Producer
+}
+
+func newReplyProducers() *replyProducers {
+	return &replyProducers{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns the producer for topic if one was created on client.
+func (r *replyProducers) get(client pulsar.Client, topic string) (pulsar.Producer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	element, found := r.entries[topic]
+	if !found || r.client != client {
+		return nil, false
+	}
+	r.order.MoveToFront(element)
+	return element.Value.(*replyProducer).producer, true
+}
+
+// add keeps producer, created on client, for topic and returns the producer to send on: an
+// earlier one when another reply created it meanwhile. Producers of a previous client are closed.
+func (r *replyProducers) add(client pulsar.Client, topic string, producer pulsar.Producer) pulsar.Producer {
+	r.mu.Lock()
+	var closing []pulsar.Producer
+	if r.client != client {
+		closing = r.drain()
+		r.client = client
+	}
+	if element, found := r.entries[topic]; found {
+		r.order.MoveToFront(element)
+		closing = append(closing, producer)
+		producer = element.Value.(*replyProducer).producer
+	} else {
+		r.entries[topic] = r.order.PushFront(&replyProducer{topic: topic, producer: producer})
+		for r.order.Len() > maxReplyProducers {
+			oldest := r.order.Remove(r.order.Back()).(*replyProducer)
+			delete(r.entries, oldest.topic)
+			closing = append(closing, oldest.producer)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, stale := range closing {
+		stale.Close()
+	}
+	return producer
+}
+
+// remove closes producer and forgets it if it is still the one kept for topic.
+func (r *replyProducers) remove(topic string, producer pulsar.Producer) {
+	r.mu.Lock()
+	element, found := r.entries[topic]
+	current := found && element.Value.(*replyProducer).producer == producer
+	if current {
+		r.order.Remove(element)
+		delete(r.entries, topic)
+	}
+	r.mu.Unlock()
+	if current {
+		producer.Close()
+	}
+}
+
+// closeAll closes every producer, on shutdown or when the client moves to another cluster.
+func (r *replyProducers) closeAll() {
+	r.mu.Lock()
+	closing := r.drain()
+	r.mu.Unlock()
+	for _, producer := range closing {
+		producer.Close()
+	}
+}
+
+// drain empties the cache and returns its producers. The caller holds r.mu.
+func (r *replyProducers) drain() []pulsar.Producer {
+	producers := make([]pulsar.Producer, 0, r.order.Len())
+	for element := r.order.Front(); element != nil; element = element.Next() {
+		producers = append(producers, element.Value.(*replyProducer).producer)
+	}
+	r.entries = make(map[string]*list.Element)
+	r.order.Init()
+	return producers
+}
@@ -0,0 +1,58 @@
+package pulsarClient
+
+import (
+	"context"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// scheduledAtProperty carries the requested delivery time of a delayed event, in RFC 3339 UTC.
+const scheduledAtProperty = "scheduled_at"
+
+// PublishEventAfter publishes an event that becomes visible to consumers once delay has passed.
+// Delayed delivery is only honoured by Shared and KeyShared subscriptions.
+func (p *pulsarClient) PublishEventAfter(ctx context.Context, topic, eventType string, payload any, delay time.Duration, opts ...PublishOption) error {
+	// Fix the delivery time now so publish retries do not push it further out.
+	return p.PublishEventAt(ctx, topic, eventType, payload, time.Now().Add(delay), opts...)
+}
+
+// PublishEventAt publishes an event that becomes visible to consumers at deliverAt.
+// Delayed delivery is only honoured by Shared and KeyShared subscriptions.
+func (p *pulsarClient) PublishEventAt(ctx context.Context, topic, eventType string, payload any, deliverAt time.Time, opts ...PublishOption) error {
+	opts = append(opts, WithDeliverAt(deliverAt))
+	return p.PublishEvent(ctx, topic, eventType, payload, opts...)
+}
+
+// WithDeliverAt schedules the message for deliverAt and records the schedule in its properties.
+func WithDeliverAt(deliverAt time.Time) PublishOption {
+	return func(message *pulsar.ProducerMessage) {
+		message.DeliverAt = deliverAt
+		WithProperties(map[string]string{
+			scheduledAtProperty: deliverAt.UTC().Format(time.RFC3339Nano),
+		})(message)
+	}
+}
+
+// ScheduledTime returns the time a delayed event was scheduled for, read from the metadata of the
+// message being handled. It reports false for events that were published without a delay.
+func ScheduledTime(ctx context.Context) (time.Time, bool) {
+	msg := messageFromContext(ctx)
+	if msg == nil {
+		return time.Time{}, false
+	}
+	return MessageScheduledTime(msg)
+}
+
+// MessageScheduledTime is ScheduledTime for a raw Pulsar message.
+func MessageScheduledTime(msg pulsar.Message) (time.Time, bool) {
+	value, found := msg.Properties()[scheduledAtProperty]
+	if !found {
+		return time.Time{}, false
+	}
+	scheduledAt, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return scheduledAt, true
+}
@@ -0,0 +1,320 @@
+package pulsarClient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/hamba/avro/v2"
+
+	"github.com/factory24/athari-thirdparty/pulsar/internal/dispatch"
+)
+
+// ErrSchemaViolation is returned (wrapped) when an event payload does not match its topic's schema.
+var ErrSchemaViolation = errors.New("schema violation")
+
+// SchemaType is the encoding of event payloads on a topic with a registered Schema.
+type SchemaType int
+
+const (
+	// SchemaJSON keeps the payload as JSON inside the flow-system envelope.
+	SchemaJSON SchemaType = iota
+	// SchemaAvro carries the payload as Avro binary inside the flow-system envelope.
+	SchemaAvro
+)
+
+func (t SchemaType) String() string {
+	if t == SchemaAvro {
+		return "avro"
+	}
+	return "json"
+}
+
+// Schema ties the payload of every event on a topic to a Go type and an Avro schema definition.
+// Register it with RegisterSchema: payloads are validated by PublishEvent, and consumers decode them
+// into a T that Router handlers receive directly and other handlers can read with EventPayload.
+// Messages that do not match are dead-lettered with reason "schema_violation".
+//
+// Validation happens in the client only. The schema is not declared to the broker, because it
+// describes the payload while the message carries the whole flow-system envelope, which
+// schema-aware readers would fail to decode.
+type Schema struct {
+	schemaType SchemaType
+	goType     reflect.Type
+	avro       avro.Schema
+	newValue   func() any
+}
+
+// NewJSONSchema creates a JSON schema for payloads of type T. definition is the Avro record
+// describing T's JSON form, as Pulsar uses for JSON schemas; it is also what payloads are
+// validated against, so required fields, unknown fields and value types are all checked.
+func NewJSONSchema[T any](definition string) (*Schema, error) {
+	return newSchema[T](SchemaJSON, definition)
+}
+
+// NewAvroSchema creates an Avro schema for payloads of type T, which maps to definition through
+// `avro` struct tags. Payloads are published as Avro binary, so PublishEvent only accepts T or *T.
+func NewAvroSchema[T any](definition string) (*Schema, error) {
+	return newSchema[T](SchemaAvro, definition)
+}
+
+func newSchema[T any](schemaType SchemaType, definition string) (*Schema, error) {
+	parsed, err := avro.Parse(definition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s schema definition: %w", schemaType, err)
+	}
+	return &Schema{
+		schemaType: schemaType,
+		goType:     reflect.TypeFor[T](),
+		avro:       parsed,
+		newValue:   func() any { return new(T) },
+	}, nil
+}
+
+// Type returns the payload encoding.
+func (s *Schema) Type() SchemaType {
+	return s.schemaType
+}
+
+// Encode validates payload and returns the value to place in the event envelope: payload itself
+// for JSON schemas, its Avro encoding for Avro schemas.
+func (s *Schema) Encode(payload any) (any, error) {
+	if s.schemaType == SchemaAvro {
+		if t := reflect.TypeOf(payload); t != s.goType && t != reflect.PointerTo(s.goType) {
+			return nil, fmt.Errorf("%w: payload is %T, want %s", ErrSchemaViolation, payload, s.goType)
+		}
+		data, err := avro.Marshal(s.avro, payload)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSchemaViolation, err)
+		}
+		return data, nil
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	if _, err := s.decodeJSON(raw); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// Decode validates the JSON-encoded payload of a consumed event envelope and returns it as a T.
+func (s *Schema) Decode(data []byte) (any, error) {
+	if s.schemaType == SchemaAvro {
+		var encoded []byte
+		if err := json.Unmarshal(data, &encoded); err != nil {
+			return nil, fmt.Errorf("%w: avro payload is not a base64 string: %v", ErrSchemaViolation, err)
+		}
+		value := s.newValue()
+		if err := avro.Unmarshal(s.avro, encoded, value); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSchemaViolation, err)
+		}
+		return reflect.ValueOf(value).Elem().Interface(), nil
+	}
+	return s.decodeJSON(data)
+}
+
+// decodeJSON checks raw against the Avro definition and then decodes it strictly into a T.
+func (s *Schema) decodeJSON(raw []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var generic any
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSchemaViolation, err)
+	}
+	if err := validateJSON(s.avro, generic, "payload"); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSchemaViolation, err)
+	}
+
+	value := s.newValue()
+	decoder = json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSchemaViolation, err)
+	}
+	return reflect.ValueOf(value).Elem().Interface(), nil
+}
+
+// validateJSON checks a decoded JSON value (numbers as json.Number) against an Avro schema.
+func validateJSON(schema avro.Schema, value any, path string) error {
+	switch s := schema.(type) {
+	case *avro.RefSchema:
+		return validateJSON(s.Schema(), value, path)
+	case *avro.RecordSchema:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %s", path, jsonKind(value))
+		}
+		known := make(map[string]bool, len(s.Fields()))
+		for _, field := range s.Fields() {
+			known[field.Name()] = true
+			fieldValue, found := object[field.Name()]
+			if !found {
+				if field.HasDefault() || isNullable(field.Type()) {
+					continue
+				}
+				return fmt.Errorf("%s.%s: required field is missing", path, field.Name())
+			}
+			if err := validateJSON(field.Type(), fieldValue, path+"."+field.Name()); err != nil {
+				return err
+			}
+		}
+		for name := range object {
+			if !known[name] {
+				return fmt.Errorf("%s.%s: unknown field", path, name)
+			}
+		}
+		return nil
+	case *avro.ArraySchema:
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %s", path, jsonKind(value))
+		}
+		for i, item := range items {
+			if err := validateJSON(s.Items(), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *avro.MapSchema:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %s", path, jsonKind(value))
+		}
+		for key, item := range object {
+			if err := validateJSON(s.Values(), item, path+"."+key); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *avro.UnionSchema:
+		for _, member := range s.Types() {
+			if validateJSON(member, value, path) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %s matches none of the union types", path, jsonKind(value))
+	case *avro.EnumSchema:
+		symbol, ok := value.(string)
+		if !ok || !slices.Contains(s.Symbols(), symbol) {
+			return fmt.Errorf("%s: expected one of %s", path, strings.Join(s.Symbols(), ", "))
+		}
+		return nil
+	case *avro.FixedSchema:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: expected string, got %s", path, jsonKind(value))
+		}
+		return nil
+	case *avro.PrimitiveSchema:
+		return validatePrimitive(s.Type(), value, path)
+	default:
+		return nil
+	}
+}
+
+func validatePrimitive(t avro.Type, value any, path string) error {
+	ok := false
+	switch t {
+	case avro.Null:
+		ok = value == nil
+	case avro.Boolean:
+		_, ok = value.(bool)
+	case avro.String, avro.Bytes:
+		_, ok = value.(string)
+	case avro.Int, avro.Long:
+		if number, isNumber := value.(json.Number); isNumber {
+			n, err := number.Int64()
+			ok = err == nil && (t == avro.Long || n >= math.MinInt32 && n <= math.MaxInt32)
+		}
+	case avro.Float, avro.Double:
+		if number, isNumber := value.(json.Number); isNumber {
+			_, err := number.Float64()
+			ok = err == nil
+		}
+	default:
+		ok = true
+	}
+	if !ok {
+		return fmt.Errorf("%s: expected %s, got %s", path, t, jsonKind(value))
+	}
+	return nil
+}
+
+func isNullable(schema avro.Schema) bool {
+	if union, ok := schema.(*avro.UnionSchema); ok {
+		return union.Nullable()
+	}
+	return schema.Type() == avro.Null
+}
+
+func jsonKind(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number " + v.String()
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// RegisterSchema attaches schema to topic. Events published and received from then on are
+// validated against it.
+func (p *pulsarClient) RegisterSchema(topic string, schema *Schema) error {
+	p.schemaMu.Lock()
+	defer p.schemaMu.Unlock()
+	name := qualifiedTopic(topic)
+	p.schemas[name] = schema
+	PulsarLogInfo("Registered %s schema %s for topic %s", schema.schemaType, schema.goType, name)
+	return nil
+}
+
+// schemaFor is called for every message, so schemas have their own lock rather than p.mu.
+func (p *pulsarClient) schemaFor(topic string) *Schema {
+	p.schemaMu.RLock()
+	defer p.schemaMu.RUnlock()
+	return p.schemas[qualifiedTopic(topic)]
+}
+
+// encodeWithSchema validates payload against the topic's schema, if any, and wraps it in the
+// flow-system event envelope.
+func (p *pulsarClient) encodeWithSchema(topic, eventType string, payload any) ([]byte, error) {
+	if schema := p.schemaFor(topic); schema != nil {
+		encoded, err := schema.Encode(payload)
+		if err != nil {
+			return nil, fmt.Errorf("event '%s' does not match the schema of topic %s: %w", eventType, topic, err)
+		}
+		payload = encoded
+	}
+	return encodeEvent(topic, eventType, payload)
+}
+
+// decodeWithSchema decodes the payload of a parsed event with schema.
+func decodeWithSchema(schema *Schema, header *EventHeader) (any, error) {
+	raw, err := json.Marshal(header.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSchemaViolation, err)
+	}
+	return schema.Decode(raw)
+}
+
+// qualifiedTopic expands a short topic name to the persistent://tenant/namespace/topic form the
+// broker reports for received messages.
+func qualifiedTopic(topic string) string {
+	return dispatch.QualifiedTopic(topic)
+}
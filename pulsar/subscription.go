@@ -0,0 +1,581 @@
+package pulsarClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	sysResponse "github.com/factory24/flow-system/pkg/response"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"golang.org/x/time/rate"
+
+	"github.com/factory24/athari-thirdparty/pulsar/internal/dispatch"
+)
+
+// partitionSuffix matches the suffix the broker appends to the partitions of a partitioned topic.
+var partitionSuffix = regexp.MustCompile(`-partition-\d+$`)
+
+// subscription is the single consumer and worker pool started by one ListenOnTopics or
+// ListenOnPattern call.
+type subscription struct {
+	name      string
+	handler   EventHandler
+	cfg       *consumerConfig
+	client    *pulsarClient
+	ctx       context.Context
+	cancel    context.CancelFunc
+	workers   sync.WaitGroup
+	closeOnce sync.Once
+	metrics   *Metrics
+	// queues are the channels messages wait in before a worker picks them up.
+	queues  []chan pulsar.ConsumerMessage
+	limiter *rate.Limiter
+
+	flowMu sync.Mutex
+	paused bool
+	// resumed is closed while the subscription is not paused.
+	resumed chan struct{}
+	// stops holds a stop channel per worker on the shared queue; key-ordered workers have none.
+	stops []chan struct{}
+	// lanes is the number of workers of a key-ordered subscription, whose dispatcher takes
+	// requests to change it from resizes.
+	lanes   int
+	resizes chan resize
+
+	// options recreate the consumer on another cluster after a failover.
+	options    pulsar.ConsumerOptions
+	consumerMu sync.Mutex
+	consumer   pulsar.Consumer
+	// stale is set when resubscribing after a failover failed, so the health monitor retries it.
+	stale  bool
+	closed bool
+
+	// ackDeadlines holds a timer per message taken by a worker that nacks the message once the
+	// ack timeout passes without an outcome.
+	ackMu        sync.Mutex
+	ackDeadlines map[string]*time.Timer
+}
+
+// close closes the consumer exactly once, whichever of Shutdown or worker exit gets there first.
+func (s *subscription) close() {
+	s.closeOnce.Do(func() {
+		s.metrics.untrackQueue(s)
+		s.consumerMu.Lock()
+		defer s.consumerMu.Unlock()
+		s.closed = true
+		s.consumer.Close()
+
+		s.ackMu.Lock()
+		defer s.ackMu.Unlock()
+		for _, timer := range s.ackDeadlines {
+			timer.Stop()
+		}
+		s.ackDeadlines = nil
+	})
+}
+
+// resubscribe replaces the consumer with one created by client. The new consumer feeds the same
+// channel, so the workers carry on. Messages still queued or being handled from the old consumer
+// can no longer be acked once it is closed, so they are redelivered.
+func (s *subscription) resubscribe(client pulsar.Client) error {
+	s.consumerMu.Lock()
+	defer s.consumerMu.Unlock()
+	if s.closed {
+		return nil
+	}
+	consumer, err := client.Subscribe(s.options)
+	if err != nil {
+		s.stale = true
+		return err
+	}
+	s.consumer.Close()
+	s.consumer = consumer
+	s.stale = false
+	return nil
+}
+
+// needsResubscribe reports whether an earlier resubscribe failed.
+func (s *subscription) needsResubscribe() bool {
+	s.consumerMu.Lock()
+	defer s.consumerMu.Unlock()
+	return s.stale && !s.closed
+}
+
+// receivedMessage remembers which consumer delivered a message, so it is never acked on the
+// consumer of another cluster, where its message ID means nothing. After a failover has closed
+// that consumer the ack fails and the message is redelivered.
+type receivedMessage struct {
+	pulsar.Message
+	consumer pulsar.Consumer
+}
+
+// consumerFor returns the consumer that delivered msg.
+func (s *subscription) consumerFor(msg pulsar.Message) (pulsar.Consumer, pulsar.Message) {
+	if received, ok := msg.(*receivedMessage); ok && received.consumer != nil {
+		return received.consumer, received.Message
+	}
+	s.consumerMu.Lock()
+	defer s.consumerMu.Unlock()
+	return s.consumer, msg
+}
+
+func (s *subscription) ack(msg pulsar.Message) {
+	s.settle(msg)
+	consumer, msg := s.consumerFor(msg)
+	consumer.Ack(msg)
+	s.metrics.acked(sourceTopic(msg), s.name)
+}
+
+func (s *subscription) nack(msg pulsar.Message) {
+	s.settle(msg)
+	consumer, msg := s.consumerFor(msg)
+	consumer.Nack(msg)
+	s.metrics.nacked(sourceTopic(msg), s.name)
+}
+
+// trackAck starts the ack timeout of msg when the subscription has one.
+func (s *subscription) trackAck(msg pulsar.Message) {
+	timeout := s.cfg.ackTimeout
+	if timeout <= 0 {
+		return
+	}
+	key := ackKey(msg)
+	s.ackMu.Lock()
+	defer s.ackMu.Unlock()
+	if s.ackDeadlines == nil {
+		s.ackDeadlines = make(map[string]*time.Timer)
+	}
+	if timer, found := s.ackDeadlines[key]; found {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		s.ackMu.Lock()
+		expired := s.ackDeadlines[key] == timer
+		if expired {
+			delete(s.ackDeadlines, key)
+		}
+		s.ackMu.Unlock()
+		if expired {
+			PulsarLogError("Message %v was not acked within %s on subscription %s. Nacking message.", msg.ID(), timeout, s.name)
+			s.nack(msg)
+		}
+	})
+	s.ackDeadlines[key] = timer
+}
+
+// settle stops the ack timeout of msg once its outcome is decided.
+func (s *subscription) settle(msg pulsar.Message) {
+	if s.cfg.ackTimeout <= 0 {
+		return
+	}
+	key := ackKey(msg)
+	s.ackMu.Lock()
+	defer s.ackMu.Unlock()
+	if timer, found := s.ackDeadlines[key]; found {
+		timer.Stop()
+		delete(s.ackDeadlines, key)
+	}
+}
+
+// ackKey identifies msg among the messages of a subscription.
+func ackKey(msg pulsar.Message) string {
+	return msg.Topic() + "|" + msg.ID().String()
+}
+
+// queueDepth returns the number of received messages not yet picked up by a worker.
+func (s *subscription) queueDepth() int {
+	s.flowMu.Lock()
+	defer s.flowMu.Unlock()
+	depth := 0
+	for _, queue := range s.queues {
+		depth += len(queue)
+	}
+	return depth
+}
+
+// dlqTopicFor returns the dead-letter topic of the topic msg was originally published to, so that
+// every topic of a multi-topic or pattern subscription keeps its own DLQ.
+func (s *subscription) dlqTopicFor(msg pulsar.Message) string {
+	return s.cfg.dlqTopic(sourceTopic(msg))
+}
+
+// baseTopic strips the partition suffix from a topic name.
+func baseTopic(topic string) string {
+	return partitionSuffix.ReplaceAllString(topic, "")
+}
+
+func (p *pulsarClient) ListenOnTopics(ctx context.Context, topics []string, subscriptionName string, handler EventHandler, opts ...ConsumerOption) (Subscription, error) {
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("no topics given for subscription %s", subscriptionName)
+	}
+	return p.listen(ctx, pulsar.ConsumerOptions{Topics: topics}, strings.Join(topics, ","), subscriptionName, handler, opts)
+}
+
+// ListenOnPattern subscribes to all topics matching topicsPattern. Make sure the pattern does not
+// also match the DLQ topics (e.g. anchor it with $), otherwise dead-lettered messages are consumed again.
+func (p *pulsarClient) ListenOnPattern(ctx context.Context, topicsPattern, subscriptionName string, handler EventHandler, opts ...ConsumerOption) (Subscription, error) {
+	if _, err := regexp.Compile(topicsPattern); err != nil {
+		return nil, fmt.Errorf("invalid topics pattern %s: %w", topicsPattern, err)
+	}
+	return p.listen(ctx, pulsar.ConsumerOptions{TopicsPattern: topicsPattern}, topicsPattern, subscriptionName, handler, opts)
+}
+
+// listen creates exactly one consumer for the subscription described by target and starts its workers.
+func (p *pulsarClient) listen(ctx context.Context, target pulsar.ConsumerOptions, description, subscriptionName string, handler EventHandler, opts []ConsumerOption) (Subscription, error) {
+	cfg := newConsumerConfig(opts)
+
+	consumerName, err := cfg.resolveConsumerName()
+	if err != nil {
+		return nil, err
+	}
+
+	channel := make(chan pulsar.ConsumerMessage, cfg.messageBufferSize())
+
+	// Dead-lettering is done by processMessage rather than a client DLQPolicy, because the policy
+	// only supports a single DLQ topic per consumer.
+	consumerOptions := target
+	if len(cfg.retrySchedule) > 0 {
+		consumerOptions.Topics = make([]string, 0, 2*len(target.Topics))
+		for _, topic := range target.Topics {
+			consumerOptions.Topics = append(consumerOptions.Topics, topic, topic+defaultRetrySuffix)
+		}
+	}
+	consumerOptions.SubscriptionName = subscriptionName
+	consumerOptions.Type = cfg.subscriptionType
+	consumerOptions.SubscriptionInitialPosition = cfg.initialPosition
+	consumerOptions.Name = consumerName
+	consumerOptions.MessageChannel = channel
+	consumerOptions.ReceiverQueueSize = cfg.receiverQueueSize
+	consumerOptions.AutoDiscoveryPeriod = cfg.autoDiscoveryPeriod
+	consumerOptions.NackRedeliveryDelay = cfg.nackRedeliveryDelay
+	consumerOptions.NackBackoffPolicy = cfg.nackBackoffPolicy
+	consumerOptions.AckGroupingOptions = cfg.ackGrouping
+	consumerOptions.MaxPendingChunkedMessage = cfg.maxPendingChunks
+	consumerOptions.ExpireTimeOfIncompleteChunk = cfg.chunkExpiry
+	consumerOptions.AutoAckIncompleteChunk = cfg.autoAckIncompleteChunks
+	consumerOptions.Decryption = &pulsar.MessageDecryptionInfo{
+		KeyReader:                   p.keyReader,
+		MessageCrypto:               nil,
+		ConsumerCryptoFailureAction: 1,
+	}
+
+	client := p.active()
+	consumer, err := client.Subscribe(consumerOptions)
+	if err != nil {
+		return nil, fmt.Errorf("could not subscribe to %s: %w", description, err)
+	}
+
+	subCtx, cancel := context.WithCancel(ctx)
+	sub := &subscription{
+		name:     subscriptionName,
+		handler:  handler,
+		cfg:      cfg,
+		consumer: consumer,
+		options:  consumerOptions,
+		client:   p,
+		ctx:      subCtx,
+		cancel:   cancel,
+		metrics:  p.metrics,
+		queues:   []chan pulsar.ConsumerMessage{channel},
+		limiter:  newLimiter(cfg.rateLimit, cfg.rateBurst),
+		resumed:  closedChannel(),
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		cancel()
+		consumer.Close()
+		return nil, ErrClientClosed
+	}
+	// A failover while subscribing left the consumer on the previous cluster.
+	sub.stale = p.active() != client
+	p.subscriptions = append(p.subscriptions, sub)
+	p.mu.Unlock()
+
+	PulsarLogSuccess("Subscribed %s to %s with %d workers", subscriptionName, description, cfg.workerCount)
+
+	if cfg.keyOrdered {
+		p.startKeyOrderedWorkers(subCtx, sub, channel)
+	} else {
+		sub.flowMu.Lock()
+		for i := 0; i < cfg.workerCount; i++ {
+			sub.startWorker()
+		}
+		sub.flowMu.Unlock()
+	}
+	p.metrics.trackQueue(sub)
+
+	// Once every worker has returned, nothing can ack or nack on the consumer any more.
+	go func() {
+		sub.workers.Wait()
+		sub.close()
+	}()
+	return sub, nil
+}
+
+// runWorker handles messages from ch until ctx is cancelled or stop is closed. A nil stop channel
+// never fires.
+func (p *pulsarClient) runWorker(ctx context.Context, sub *subscription, ch <-chan pulsar.ConsumerMessage, stop <-chan struct{}) {
+	defer sub.workers.Done()
+	for {
+		// Check for cancellation first so a full channel cannot keep a stopping worker busy.
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case cm, ok := <-ch:
+			if !ok {
+				// Only the lanes of a key-ordered subscription are closed, once it is rescaled
+				// and the worker has handled what was left in its lane.
+				return
+			}
+			msg := &receivedMessage{Message: cm.Message, consumer: cm.Consumer}
+			sub.trackAck(msg)
+			// A message received while paused stays unacked, and is redelivered if the
+			// subscription stops before it resumes.
+			if err := sub.waitTurn(ctx); err != nil {
+				return
+			}
+
+			// In-flight handlers are allowed to finish during shutdown, so they do not
+			// inherit the subscription's cancellation.
+			p.processMessage(context.WithoutCancel(ctx), sub, msg)
+
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// resize asks the dispatcher of a key-ordered subscription to move to workers workers. done is
+// closed once the new workers are running.
+type resize struct {
+	workers int
+	done    chan struct{}
+}
+
+// startKeyOrderedWorkers gives every worker its own channel and routes each message by a hash of
+// its key, so all messages for one key are handled sequentially by the same worker. Messages
+// without a key are spread round-robin.
+func (p *pulsarClient) startKeyOrderedWorkers(ctx context.Context, sub *subscription, in <-chan pulsar.ConsumerMessage) {
+	sub.resizes = make(chan resize)
+	lanes, drained := p.startLanes(ctx, sub, sub.cfg.workerCount)
+
+	sub.workers.Add(1)
+	go func() {
+		defer sub.workers.Done()
+		next := 0
+		for {
+			select {
+			case cm, ok := <-in:
+				if !ok {
+					return
+				}
+				var lane int
+				if key := messageOrderingKey(cm.Message); key != "" {
+					lane = int(fnv32a(key) % uint32(len(lanes)))
+				} else {
+					lane = next
+					next = (next + 1) % len(lanes)
+				}
+				select {
+				case lanes[lane] <- cm:
+				case <-ctx.Done():
+					return
+				}
+			case r := <-sub.resizes:
+				// Keys move to other workers when the count changes, so the current workers
+				// finish everything routed to them before the new ones start.
+				for _, lane := range lanes {
+					close(lane)
+				}
+				drained.Wait()
+				lanes, drained = p.startLanes(ctx, sub, r.workers)
+				next = 0
+				close(r.done)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// startLanes starts workerCount key-ordered workers, each on its own channel. drained is done once
+// all of them have returned.
+func (p *pulsarClient) startLanes(ctx context.Context, sub *subscription, workerCount int) ([]chan pulsar.ConsumerMessage, *sync.WaitGroup) {
+	bufferSize := sub.cfg.messageBufferSize() / workerCount
+	lanes := make([]chan pulsar.ConsumerMessage, workerCount)
+	drained := &sync.WaitGroup{}
+
+	sub.workers.Add(workerCount)
+	drained.Add(workerCount)
+	for i := range lanes {
+		lanes[i] = make(chan pulsar.ConsumerMessage, bufferSize)
+		go func(lane <-chan pulsar.ConsumerMessage) {
+			defer drained.Done()
+			p.runWorker(ctx, sub, lane, nil)
+		}(lanes[i])
+	}
+
+	sub.flowMu.Lock()
+	sub.queues = append(sub.queues[:1:1], lanes...)
+	sub.lanes = workerCount
+	sub.flowMu.Unlock()
+	return lanes, drained
+}
+
+// messageOrderingKey returns the key Key_Shared delivery uses: the ordering key if set, else the message key.
+func messageOrderingKey(msg pulsar.Message) string {
+	if key := msg.OrderingKey(); key != "" {
+		return key
+	}
+	return msg.Key()
+}
+
+func fnv32a(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+func (p *pulsarClient) processMessage(ctx context.Context, sub *subscription, msg pulsar.Message) {
+	header, err := sysResponse.ParseEventHeader(msg.Payload())
+	if err != nil {
+		PulsarLogError("Failed to parse event header for message %v: %v", msg.ID(), err)
+		p.deadLetter(sub, msg, "unparseable_payload", err.Error())
+		return
+	}
+	if header, err = p.upcasters.upcastHeader(msg, header); err != nil {
+		PulsarLogError("Failed to upcast event for message %v: %v", msg.ID(), err)
+		p.deadLetter(sub, msg, "upcast_failed", err.Error())
+		return
+	}
+	if schema := p.schemaFor(sourceTopic(msg)); schema != nil {
+		payload, err := decodeWithSchema(schema, header)
+		if err != nil {
+			PulsarLogError("Event '%s' (ID: %v) does not match the schema of its topic: %v", header.EventType, msg.ID(), err)
+			p.deadLetter(sub, msg, "schema_violation", err.Error())
+			return
+		}
+		ctx = dispatch.WithPayload(ctx, payload)
+	}
+
+	var eventID string
+	if sub.cfg.dedupStore != nil {
+		eventID = dedupID(header, msg)
+		seen, err := sub.cfg.dedupStore.Seen(ctx, eventID)
+		if err != nil {
+			PulsarLogError("Dedup lookup failed for event %s, processing anyway: %v", eventID, err)
+		} else if seen {
+			PulsarLogInfo("Skipping duplicate event '%s' (event ID: %s, message ID: %v)", header.EventType, eventID, msg.ID())
+			sub.ack(msg)
+			return
+		}
+	}
+
+	header.PrettyLog()
+	started := time.Now()
+	spanCtx, span := p.startProcessSpan(ctx, sub, msg, header.EventType)
+	err = dispatchEvent(spanCtx, sub.handler, msg, header)
+	endSpan(span, err)
+	if err != nil {
+		var dlErr *deadLetterError
+		if errors.As(err, &dlErr) {
+			p.metrics.handled(sourceTopic(msg), header.EventType, "dead_letter", time.Since(started))
+			PulsarLogError("Handler rejected event '%s' (ID: %v): %v. Dead-lettering message.", header.EventType, msg.ID(), dlErr.err)
+			p.deadLetter(sub, msg, dlErr.reason, dlErr.Error())
+			return
+		}
+		p.metrics.handled(sourceTopic(msg), header.EventType, "error", time.Since(started))
+		if len(sub.cfg.retrySchedule) > 0 {
+			scheduled, retryErr := p.scheduleRetry(sub, msg, err)
+			switch {
+			case retryErr != nil:
+				PulsarLogError("Handler failed to process event '%s' (ID: %v): %v. Retry failed (%v), nacking message.", header.EventType, msg.ID(), err, retryErr)
+				sub.nack(msg)
+			case scheduled:
+				sub.ack(msg)
+			default:
+				PulsarLogError("Handler failed to process event '%s' (ID: %v) after %d retries: %v. Dead-lettering message.", header.EventType, msg.ID(), retryCount(msg), err)
+				p.deadLetter(sub, msg, "retries_exhausted", err.Error())
+			}
+			return
+		}
+		if sub.cfg.dlqEnabled && msg.RedeliveryCount()+1 >= sub.cfg.maxDeliveries {
+			PulsarLogError("Handler failed to process event '%s' (ID: %v) on delivery %d: %v. Dead-lettering message.", header.EventType, msg.ID(), msg.RedeliveryCount()+1, err)
+			p.deadLetter(sub, msg, "max_deliveries_exceeded", err.Error())
+			return
+		}
+		if delay, found := NackDelay(err); found {
+			PulsarLogError("Handler failed to process event '%s' (ID: %v): %v. Nacking message in %s.", header.EventType, msg.ID(), err, delay)
+			sub.settle(msg)
+			time.AfterFunc(delay, func() { sub.nack(msg) })
+			return
+		}
+		PulsarLogError("Handler failed to process event '%s' (ID: %v): %v. Nacking message.", header.EventType, msg.ID(), err)
+		sub.nack(msg)
+	} else {
+		p.metrics.handled(sourceTopic(msg), header.EventType, "success", time.Since(started))
+		PulsarLogSuccess("Successfully processed event '%s' (ID: %v)", header.EventType, msg.ID())
+		if sub.cfg.dedupStore != nil {
+			if err := sub.cfg.dedupStore.Mark(ctx, eventID, sub.cfg.dedupTTL); err != nil {
+				PulsarLogError("Failed to record event %s as processed: %v", eventID, err)
+			}
+		}
+		sub.ack(msg)
+	}
+}
+
+// deadLetter moves msg to the DLQ of its topic and acks it, or nacks it when the DLQ publish fails
+// so the message is not lost. Without a DLQ the message is simply acked.
+func (p *pulsarClient) deadLetter(sub *subscription, msg pulsar.Message, reason, errorDetail string) {
+	if dlqTopic := sub.dlqTopicFor(msg); dlqTopic != "" {
+		PulsarLogError("Sending message %v to DLQ topic %s (reason: %s)", msg.ID(), dlqTopic, reason)
+		p.ensureDLQSubscription(dlqTopic, sub.name)
+		dlqErr := p.sendToDLQ(dlqTopic, msg, reason, errorDetail)
+		p.metrics.deadLettered(sourceTopic(msg), reason, dlqErr)
+		if dlqErr != nil {
+			PulsarLogError("CRITICAL: Failed to send message %v to DLQ: %v. Nacking.", msg.ID(), dlqErr)
+			sub.nack(msg)
+			return
+		}
+	}
+	sub.ack(msg)
+}
+
+// ensureDLQSubscription creates subscriptionName on dlqTopic the first time it is used, so that
+// dead-lettered messages are retained until someone processes them.
+func (p *pulsarClient) ensureDLQSubscription(dlqTopic, subscriptionName string) {
+	key := dlqTopic + "|" + subscriptionName
+	p.mu.RLock()
+	ready := p.dlqReady[key]
+	p.mu.RUnlock()
+	if ready {
+		return
+	}
+
+	consumer, err := p.active().Subscribe(pulsar.ConsumerOptions{
+		Topic:                       dlqTopic,
+		SubscriptionName:            subscriptionName,
+		Type:                        pulsar.Shared,
+		SubscriptionInitialPosition: pulsar.SubscriptionPositionEarliest,
+	})
+	if err != nil {
+		PulsarLogError("Failed to create subscription %s on DLQ topic %s: %v", subscriptionName, dlqTopic, err)
+		return
+	}
+	consumer.Close()
+
+	p.mu.Lock()
+	p.dlqReady[key] = true
+	p.mu.Unlock()
+}
@@ -0,0 +1,82 @@
+package pulsarClient
+
+import (
+	"context"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/factory24/athari-thirdparty/pulsar"
+
+// tracePropagator carries W3C trace context and baggage in message properties, regardless of the
+// globally configured propagator.
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// WithTracerProvider sets the OpenTelemetry tracer provider for publish and process spans. By
+// default the global provider is used, which does nothing until the application installs one.
+func WithTracerProvider(provider trace.TracerProvider) ClientOption {
+	return func(p *pulsarClient) {
+		p.tracerProvider = provider
+	}
+}
+
+func (p *pulsarClient) tracer() trace.Tracer {
+	if p.tracerProvider != nil {
+		return p.tracerProvider.Tracer(tracerName)
+	}
+	return otel.Tracer(tracerName)
+}
+
+// startPublishSpan starts a producer span for an event published to topic.
+func (p *pulsarClient) startPublishSpan(ctx context.Context, topic, eventType string) (context.Context, trace.Span) {
+	return p.tracer().Start(ctx, "publish "+topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("pulsar"),
+			semconv.MessagingDestinationName(topic),
+			semconv.MessagingOperationTypePublish,
+			attribute.String("messaging.pulsar.event_type", eventType),
+		),
+	)
+}
+
+// startProcessSpan continues the trace carried by msg with a consumer span around its handler.
+func (p *pulsarClient) startProcessSpan(ctx context.Context, sub *subscription, msg pulsar.Message, eventType string) (context.Context, trace.Span) {
+	ctx = tracePropagator.Extract(ctx, propagation.MapCarrier(msg.Properties()))
+	topic := sourceTopic(msg)
+	return p.tracer().Start(ctx, "process "+topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("pulsar"),
+			semconv.MessagingDestinationName(topic),
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingMessageID(msg.ID().String()),
+			attribute.String("messaging.pulsar.subscription", sub.name),
+			attribute.String("messaging.pulsar.event_type", eventType),
+			attribute.Int("messaging.pulsar.redelivery_count", int(msg.RedeliveryCount())),
+		),
+	)
+}
+
+// injectTraceContext writes the trace context of ctx into the message properties.
+func injectTraceContext(ctx context.Context, msg *pulsar.ProducerMessage) {
+	if msg.Properties == nil {
+		msg.Properties = make(map[string]string)
+	}
+	tracePropagator.Inject(ctx, propagation.MapCarrier(msg.Properties))
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
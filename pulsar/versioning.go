@@ -0,0 +1,154 @@
+package pulsarClient
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	sysResponse "github.com/factory24/flow-system/pkg/response"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// eventVersionProperty carries the payload version of an event. Events without it are version 1.
+const eventVersionProperty = "event_version"
+
+// UpcastFunc converts the JSON payload of an event from one version to the next.
+type UpcastFunc func(payload json.RawMessage) (json.RawMessage, error)
+
+type upcastKey struct {
+	eventType   string
+	fromVersion int
+}
+
+// Upcasters is a registry of payload migrations per event type. Published events are stamped with
+// the latest version of their type, and consumed events of an older version are passed through
+// each registered step in turn, so handlers only ever see the latest payload shape:
+//
+//	upcasters := pulsarClient.NewUpcasters()
+//	upcasters.Register("payment.completed", 1, addCurrencyField) // v1 -> v2
+//	client := pulsarClient.NewPulsarClient(pulsarClient.WithUpcasters(upcasters))
+type Upcasters struct {
+	mu     sync.RWMutex
+	steps  map[upcastKey]UpcastFunc
+	latest map[string]int
+}
+
+// NewUpcasters creates an empty registry.
+func NewUpcasters() *Upcasters {
+	return &Upcasters{
+		steps:  make(map[upcastKey]UpcastFunc),
+		latest: make(map[string]int),
+	}
+}
+
+// WithUpcasters versions published events and upcasts consumed ones with upcasters.
+func WithUpcasters(upcasters *Upcasters) ClientOption {
+	return func(p *pulsarClient) {
+		p.upcasters = upcasters
+	}
+}
+
+// Register adds the step that upgrades eventType payloads from fromVersion to fromVersion+1. The
+// latest version of eventType becomes one above its highest registered step.
+func (u *Upcasters) Register(eventType string, fromVersion int, fn UpcastFunc) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.steps[upcastKey{eventType: eventType, fromVersion: fromVersion}] = fn
+	if fromVersion+1 > u.latest[eventType] {
+		u.latest[eventType] = fromVersion + 1
+	}
+}
+
+// LatestVersion returns the version events of eventType are published with, 1 if no upcaster is
+// registered for it.
+func (u *Upcasters) LatestVersion(eventType string) int {
+	if latest, found := u.declaredVersion(eventType); found {
+		return latest
+	}
+	return 1
+}
+
+// declaredVersion returns the latest version of eventType, or false if no upcaster is registered for it.
+func (u *Upcasters) declaredVersion(eventType string) (int, bool) {
+	if u == nil {
+		return 0, false
+	}
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	latest, found := u.latest[eventType]
+	return latest, found
+}
+
+// Upcast brings the payload of an encoded flow-system event of the given version up to the latest
+// version and returns the re-encoded event. A missing step in the chain is an error.
+func (u *Upcasters) Upcast(eventType string, version int, event []byte) ([]byte, error) {
+	latest := u.LatestVersion(eventType)
+	if version >= latest {
+		return event, nil
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(event, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to decode event '%s' for upcasting: %w", eventType, err)
+	}
+	payload := envelope["payload"]
+	for v := version; v < latest; v++ {
+		u.mu.RLock()
+		step, found := u.steps[upcastKey{eventType: eventType, fromVersion: v}]
+		u.mu.RUnlock()
+		if !found {
+			return nil, fmt.Errorf("no upcaster registered for event '%s' version %d", eventType, v)
+		}
+		var err error
+		if payload, err = step(payload); err != nil {
+			return nil, fmt.Errorf("failed to upcast event '%s' from version %d: %w", eventType, v, err)
+		}
+	}
+	envelope["payload"] = payload
+	return json.Marshal(envelope)
+}
+
+// upcastHeader returns header with its payload upcast to the latest version, or header itself
+// when msg is already up to date.
+func (u *Upcasters) upcastHeader(msg pulsar.Message, header *EventHeader) (*EventHeader, error) {
+	version := MessageEventVersion(msg)
+	if version >= u.LatestVersion(header.EventType) {
+		return header, nil
+	}
+	event, err := u.Upcast(header.EventType, version, msg.Payload())
+	if err != nil {
+		return nil, err
+	}
+	return sysResponse.ParseEventHeader(event)
+}
+
+// WithEventVersion publishes the event as the given payload version instead of the latest one.
+func WithEventVersion(version int) PublishOption {
+	return WithProperties(map[string]string{
+		eventVersionProperty: strconv.Itoa(version),
+	})
+}
+
+// stampEventVersion records the latest version of eventType on msg when upcasters declares one
+// and no version was set with WithEventVersion. Other events go out without a version, which
+// consumers read as version 1.
+func stampEventVersion(upcasters *Upcasters, eventType string, msg *pulsar.ProducerMessage) {
+	if _, found := msg.Properties[eventVersionProperty]; found {
+		return
+	}
+	if latest, found := upcasters.declaredVersion(eventType); found {
+		WithEventVersion(latest)(msg)
+	}
+}
+
+// MessageEventVersion returns the payload version msg was published with, 1 for events published
+// before versioning.
+func MessageEventVersion(msg pulsar.Message) int {
+	version, err := strconv.Atoi(msg.Properties()[eventVersionProperty])
+	if err != nil || version < 1 {
+		return 1
+	}
+	return version
+}